@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// BackupDisc images the disc with "makemkvcon backup --decrypt" into <outdir>/<name>, named by -n or the
+// disc's volume label. The backup is written to a staging folder first and renamed into place when
+// complete, so an interrupted backup is never mistaken for a good one.
+func BackupDisc(ctx context.Context, args Arguments) error {
+	if args.Drive == "" {
+		fmt.Println("Drive not specified. Use -d or --drive to specify the drive.")
+		printUsage()
+		os.Exit(1)
+	}
+	if args.OutDir == "" {
+		fmt.Println("Output directory not specified. Use -o or --outdir to specify the output directory.")
+		printUsage()
+		os.Exit(1)
+	}
+
+	release, err := lockDrive(discSource(args))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	err = backupDisc(ctx, args)
+	ejectAfter(args, err)
+	return err
+}
+
+func backupDisc(ctx context.Context, args Arguments) error {
+	disc, err := ScanDisc(args)
+	if err != nil {
+		return err
+	}
+	name := sanitizeFilename(firstNonEmpty(args.Name, disc.Volume, disc.Name))
+	if name == "" {
+		return errors.New("disc has no volume label or name, use -n to name the backup")
+	}
+	dest := filepath.Join(args.OutDir, name)
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("backup %s already exists", dest)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := os.MkdirAll(args.OutDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(args.OutDir, ".ripmkv-backup-*")
+	if err != nil {
+		return fmt.Errorf("error creating staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.CommandContext(ctx, "makemkvcon", "backup", "--decrypt", "--progress", "--noscan", discSource(args), tmpDir)
+	cmd.Cancel = func() error {
+		fmt.Println("Interrupted. Stopping makemkvcon and waiting for it to release the drive...")
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 30 * time.Second
+
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	cmd.Stdout = os.Stdout
+	fmt.Printf("Backing up %s to %s...\n", firstNonEmpty(disc.Name, disc.Volume), dest)
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return errors.New("backup cancelled")
+		}
+		return fmt.Errorf("makemkvcon: %v: %s", err, strings.TrimSpace(errb.String()))
+	}
+
+	if err := os.Rename(tmpDir, dest); err != nil {
+		return fmt.Errorf("error finalizing backup: %w", err)
+	}
+	if err := syncDir(args.OutDir); err != nil {
+		return fmt.Errorf("error finalizing backup: %w", err)
+	}
+	fmt.Printf("✓ Done. Backup written to: %s\n", dest)
+	fmt.Printf("Rip it later with: ripmkv -d %s ...\n", shellJoin([]string{"file:" + dest}))
+	return nil
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BatchSource is the result of one backup in a batch, recorded in <outdir>/.ripmkv-batch.json.
+type BatchSource struct {
+	Source  string    `json:"source"`
+	Volume  string    `json:"volume,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Status  string    `json:"status"` // done | failed | cancelled
+	Error   string    `json:"error,omitempty"`
+	Outputs []string  `json:"outputs,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+type BatchResults struct {
+	path    string
+	Sources []BatchSource `json:"sources"`
+}
+
+func LoadBatchResults(outDir string) (*BatchResults, error) {
+	results := &BatchResults{path: filepath.Join(outDir, ".ripmkv-batch.json")}
+	data, err := os.ReadFile(results.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (b *BatchResults) Find(source string) (BatchSource, bool) {
+	for _, s := range b.Sources {
+		if s.Source == source {
+			return s, true
+		}
+	}
+	return BatchSource{}, false
+}
+
+func (b *BatchResults) Update(result BatchSource) error {
+	result.Updated = time.Now().UTC()
+	b.Sources = filter(b.Sources, func(s BatchSource) bool { return s.Source != result.Source })
+	b.Sources = append(b.Sources, result)
+	sort.Slice(b.Sources, func(i, j int) bool { return b.Sources[i].Source < b.Sources[j].Source })
+	return b.Save()
+}
+
+func (b *BatchResults) Save() error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// findBackups walks dir for ISO images and BDMV/VIDEO_TS backup folders and returns them as makemkvcon
+// sources. Folders that are a backup are not descended into.
+func findBackups(dir string) ([]string, error) {
+	var sources []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			if strings.EqualFold(filepath.Ext(path), ".iso") {
+				sources = append(sources, "iso:"+path)
+			}
+			return nil
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		for _, marker := range []string{"BDMV", "VIDEO_TS"} {
+			if info, err := os.Stat(filepath.Join(path, marker)); err == nil && info.IsDir() {
+				sources = append(sources, "file:"+path)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	return sources, err
+}
+
+// readBatchNames reads the --names mapping of volume label, source file name or source path to output name.
+func readBatchNames(path string) map[string]string {
+	names := map[string]string{}
+	if path == "" {
+		return names
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Failed to read names:", err)
+		os.Exit(1)
+	}
+	if err := json.Unmarshal(data, &names); err != nil {
+		fmt.Printf("Failed to parse names %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	return names
+}
+
+// batchName names a source from the mapping, falling back to its volume label, e.g. "THE_DARK_KNIGHT"
+// becomes "The Dark Knight", and last to the disc name.
+func batchName(source string, disc Disc, names map[string]string) string {
+	path := source[strings.Index(source, ":")+1:]
+	for _, key := range []string{disc.Volume, filepath.Base(path), path} {
+		if name, ok := names[key]; ok && key != "" {
+			return name
+		}
+	}
+	if name := volumeName(disc.Volume); name != "" {
+		return name
+	}
+	return firstNonEmpty(disc.Name, filepath.Base(path))
+}
+
+func volumeName(label string) string {
+	words := strings.Fields(strings.ReplaceAll(label, "_", " "))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + strings.ToLower(word[1:])
+	}
+	return strings.Join(words, " ")
+}
+
+// BatchRip lists or rips every backup below the given directories, one after the other. A failing source
+// is recorded and the batch moves on; with --resume, sources recorded as done are skipped.
+func BatchRip(ctx context.Context, args Arguments, config Config) {
+	if len(args.Paths) == 0 {
+		fmt.Println("No directory specified. Usage: ripmkv batch <dir>...")
+		os.Exit(1)
+	}
+	if args.Drive != "" {
+		fmt.Println("Batch rips the backups it finds, -d cannot be used with batch.")
+		os.Exit(1)
+	}
+	names := readBatchNames(args.NamesFile)
+
+	var sources []string
+	for _, dir := range args.Paths {
+		found, err := findBackups(dir)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", dir, err)
+			os.Exit(1)
+		}
+		sources = append(sources, found...)
+	}
+	if len(sources) == 0 {
+		fmt.Println("No ISO images or BDMV/VIDEO_TS folders found.")
+		return
+	}
+
+	if args.List || args.Explain || args.DryRun {
+		for i, source := range sources {
+			fmt.Printf("\n[%d/%d] %s\n", i+1, len(sources), source)
+			sourceArgs := args
+			sourceArgs.Drive = source
+			disc, err := ScanDisc(sourceArgs)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			sourceArgs.Name = batchName(source, disc, names)
+			switch {
+			case args.DryRun:
+				PlanDisc(sourceArgs, config)
+			case args.Explain:
+				PrintSelection(disc, sourceArgs, config)
+			default:
+				fmt.Printf("Name:      %s\n", sourceArgs.Name)
+				PrintDiscTree(disc, sourceArgs, config)
+			}
+		}
+		return
+	}
+
+	args.Drive = sources[0]
+	args = validateRipArgs(args)
+	if err := os.MkdirAll(args.OutDir, 0o755); err != nil {
+		fmt.Println("Failed to create output directory:", err)
+		os.Exit(1)
+	}
+	results, err := LoadBatchResults(args.OutDir)
+	if err != nil {
+		fmt.Println("Error reading batch results:", err)
+		os.Exit(1)
+	}
+
+	var summary []BatchSource
+	used := map[string]bool{}
+	for i, source := range sources {
+		result := BatchSource{Source: source}
+		if ctx.Err() != nil {
+			result.Status = "cancelled"
+			summary = append(summary, result)
+			continue
+		}
+		if previous, ok := results.Find(source); ok && args.Resume && previous.Status == "done" {
+			fmt.Printf("\n[%d/%d] %s already ripped, skipping.\n", i+1, len(sources), source)
+			summary = append(summary, previous)
+			used[previous.Name] = true
+			continue
+		}
+
+		fmt.Printf("\n[%d/%d] %s\n", i+1, len(sources), source)
+		result = ripBatchSource(ctx, source, args, config, names, used)
+		if err := results.Update(result); err != nil {
+			fmt.Println("Error writing batch results:", err)
+		}
+		summary = append(summary, result)
+	}
+
+	printBatchSummary(summary, args.OutDir)
+	failed := filter(summary, func(s BatchSource) bool { return s.Status != "done" })
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
+}
+
+func ripBatchSource(ctx context.Context, source string, args Arguments, config Config, names map[string]string, used map[string]bool) BatchSource {
+	result := BatchSource{Source: source}
+	args.Drive = source
+
+	disc, err := ScanDisc(args)
+	if err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		fmt.Println(err)
+		runDiscFailureHooks(config, disc, args, err)
+		return result
+	}
+	result.Volume = disc.Volume
+	result.Name = batchName(source, disc, names)
+	// Generic volume labels such as "DVD_VIDEO" repeat across a batch; keep outputs apart by source.
+	if used[result.Name] {
+		path := source[strings.Index(source, ":")+1:]
+		result.Name = fmt.Sprintf("%s (%s)", result.Name, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	used[result.Name] = true
+	args.Name = result.Name
+	fmt.Printf("Name:      %s\n", result.Name)
+
+	titles, err := ripScannedDisc(ctx, disc, args, config)
+	for _, t := range titles {
+		if t.Output != "" {
+			result.Outputs = append(result.Outputs, t.Output)
+		}
+	}
+	switch {
+	case ctx.Err() != nil:
+		result.Status, result.Error = "cancelled", ctx.Err().Error()
+	case err != nil:
+		result.Status, result.Error = "failed", err.Error()
+		fmt.Println(err)
+	default:
+		result.Status = "done"
+	}
+	return result
+}
+
+func printBatchSummary(summary []BatchSource, outDir string) {
+	done := filter(summary, func(s BatchSource) bool { return s.Status == "done" })
+
+	fmt.Println()
+	fmt.Println("Batch:")
+	for _, s := range summary {
+		switch s.Status {
+		case "done":
+			fmt.Printf("  ✓ %s  %s (%d file(s))\n", s.Source, s.Name, len(s.Outputs))
+		case "failed":
+			fmt.Printf("  ✗ %s  %s\n", s.Source, s.Error)
+		case "cancelled":
+			fmt.Printf("  - %s  cancelled\n", s.Source)
+		}
+	}
+	fmt.Printf("%d of %d source(s) ripped to: %s\n", len(done), len(summary), outDir)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+type Chapter struct {
+	Start string // "HH:MM:SS.mmm"
+	Name  string
+}
+
+// chapterData is what --chapter-template is executed against.
+type chapterData struct {
+	Number int    // 1-based chapter number
+	Start  string // "HH:MM:SS.mmm"
+	Name   string // the current name, e.g. "Chapter 01"
+	Title  Title
+}
+
+var ogmChapterRegex = regexp.MustCompile(`^CHAPTER(\d+)(NAME)?=(.*)$`)
+
+// readChapters extracts the chapters of an MKV in OGM format with mkvextract.
+func readChapters(file string, tmpDir string) ([]Chapter, error) {
+	out := filepath.Join(tmpDir, filepath.Base(file)+".chapters.txt")
+	defer os.Remove(out)
+
+	mkvextract := exec.Command("mkvextract", file, "chapters", "--simple", out)
+	if output, err := mkvextract.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("mkvextract: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		return nil, err
+	}
+	return parseOGMChapters(string(data)), nil
+}
+
+func parseOGMChapters(text string) []Chapter {
+	var chapters []Chapter
+	index := map[string]int{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		matches := ogmChapterRegex.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if matches == nil {
+			continue
+		}
+		i, ok := index[matches[1]]
+		if !ok {
+			i = len(chapters)
+			index[matches[1]] = i
+			chapters = append(chapters, Chapter{})
+		}
+		if matches[2] == "NAME" {
+			chapters[i].Name = matches[3]
+		} else {
+			chapters[i].Start = matches[3]
+		}
+	}
+	return chapters
+}
+
+func readChapterNames(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Failed to read chapter names:", err)
+		os.Exit(1)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names
+}
+
+func chapterTemplate(text string) *template.Template {
+	if text == "" {
+		return nil
+	}
+	tmpl, err := template.New("chapter").Option("missingkey=error").Parse(text)
+	if err != nil {
+		fmt.Println("Invalid chapter template:", err)
+		os.Exit(1)
+	}
+	return tmpl
+}
+
+// renameChapters names chapters from the user-supplied list first, then the template.
+// Chapters beyond the list without a template keep their names.
+func renameChapters(chapters []Chapter, names []string, tmpl *template.Template, t Title) ([]Chapter, error) {
+	renamed := append([]Chapter(nil), chapters...)
+	for i := range renamed {
+		switch {
+		case i < len(names):
+			renamed[i].Name = names[i]
+		case tmpl != nil:
+			var b strings.Builder
+			data := chapterData{Number: i + 1, Start: renamed[i].Start, Name: renamed[i].Name, Title: t}
+			if err := tmpl.Execute(&b, data); err != nil {
+				return nil, err
+			}
+			renamed[i].Name = b.String()
+		}
+	}
+	return renamed, nil
+}
+
+func writeChapterXML(path string, chapters []Chapter, lang string) error {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	b.WriteString("<!DOCTYPE Chapters SYSTEM \"matroskachapters.dtd\">\n")
+	b.WriteString("<Chapters>\n")
+	b.WriteString("  <EditionEntry>\n")
+	for _, c := range chapters {
+		b.WriteString("    <ChapterAtom>\n")
+		fmt.Fprintf(&b, "      <ChapterTimeStart>%s</ChapterTimeStart>\n", c.Start)
+		b.WriteString("      <ChapterDisplay>\n")
+		fmt.Fprintf(&b, "        <ChapterString>%s</ChapterString>\n", xmlEscape(c.Name))
+		fmt.Fprintf(&b, "        <ChapterLanguage>%s</ChapterLanguage>\n", matroskaLang(lang))
+		b.WriteString("      </ChapterDisplay>\n")
+		b.WriteString("    </ChapterAtom>\n")
+	}
+	b.WriteString("  </EditionEntry>\n")
+	b.WriteString("</Chapters>\n")
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func writeChapterOGM(path string, chapters []Chapter) error {
+	var b strings.Builder
+	for i, c := range chapters {
+		fmt.Fprintf(&b, "CHAPTER%02d=%s\n", i+1, c.Start)
+		fmt.Fprintf(&b, "CHAPTER%02dNAME=%s\n", i+1, c.Name)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func chapterLang(config Config) string {
+	if len(config.PreferredLanguages) > 0 {
+		return config.PreferredLanguages[0]
+	}
+	return "eng"
+}
+
+// processChapters renames the chapters of a staged file and writes them back with mkvpropedit.
+// It returns the final chapter list for export.
+func processChapters(file string, t Title, args Arguments, config Config, tmpDir string) ([]Chapter, error) {
+	chapters, err := readChapters(file, tmpDir)
+	if err != nil || len(chapters) == 0 {
+		return nil, err
+	}
+
+	var names []string
+	if args.ChapterNames != "" {
+		names = readChapterNames(args.ChapterNames)
+		if len(names) != len(chapters) {
+			fmt.Printf("Title %02d has %d chapter(s) but %d name(s) were given.\n", t.ID, len(chapters), len(names))
+		}
+	}
+	tmpl := chapterTemplate(args.ChapterTemplate)
+	if names == nil && tmpl == nil {
+		return chapters, nil
+	}
+
+	chapters, err = renameChapters(chapters, names, tmpl, t)
+	if err != nil {
+		return nil, err
+	}
+	xml := filepath.Join(tmpDir, filepath.Base(file)+".chapters.xml")
+	defer os.Remove(xml)
+	if err := writeChapterXML(xml, chapters, chapterLang(config)); err != nil {
+		return nil, err
+	}
+	mkvpropedit := exec.Command("mkvpropedit", file, "--chapters", xml)
+	if output, err := mkvpropedit.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("mkvpropedit: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return chapters, nil
+}
+
+// exportChapters writes <output>.chapters.xml and <output>.chapters.txt next to the output.
+func exportChapters(dest string, chapters []Chapter, config Config) error {
+	base := strings.TrimSuffix(dest, filepath.Ext(dest))
+	if err := writeChapterXML(base+".chapters.xml", chapters, chapterLang(config)); err != nil {
+		return err
+	}
+	return writeChapterOGM(base+".chapters.txt", chapters)
+}
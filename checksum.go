@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type hashAlgorithm struct {
+	SumsFile string
+	New      func() hash.Hash
+}
+
+var hashAlgorithms = map[string]hashAlgorithm{
+	"sha256": {SumsFile: "SHA256SUMS", New: sha256.New},
+	"xxh64":  {SumsFile: "XXH64SUMS", New: func() hash.Hash { return newXXH64() }},
+}
+
+// fileHashes computes every requested digest of a file in a single pass.
+type fileHashes struct {
+	names   []string
+	hashers []hash.Hash
+}
+
+func newFileHashes(names []string) *fileHashes {
+	h := &fileHashes{}
+	for _, name := range names {
+		h.names = append(h.names, name)
+		h.hashers = append(h.hashers, hashAlgorithms[name].New())
+	}
+	return h
+}
+
+func (h *fileHashes) Writer() io.Writer {
+	writers := make([]io.Writer, len(h.hashers))
+	for i, hasher := range h.hashers {
+		writers[i] = hasher
+	}
+	return io.MultiWriter(writers...)
+}
+
+// Record upserts the file's digests into the sums files next to it.
+func (h *fileHashes) Record(file string) error {
+	for i, name := range h.names {
+		sums := filepath.Join(filepath.Dir(file), hashAlgorithms[name].SumsFile)
+		if err := upsertSum(sums, filepath.Base(file), hex.EncodeToString(h.hashers[i].Sum(nil))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forget removes the file from the sums files next to it.
+func (h *fileHashes) Forget(file string) error {
+	for _, name := range h.names {
+		if err := removeSum(filepath.Join(filepath.Dir(file), hashAlgorithms[name].SumsFile), filepath.Base(file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hashNames validates --hash, defaulting to sha256. "none" disables checksums.
+func hashNames(names []string) []string {
+	if len(names) == 0 {
+		return []string{"sha256"}
+	}
+	var out []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if name == "none" {
+			return nil
+		}
+		if _, ok := hashAlgorithms[name]; !ok {
+			fmt.Printf("Unsupported hash %q, expected one of: sha256, xxh64, none\n", name)
+			os.Exit(1)
+		}
+		out = append(out, name)
+	}
+	return out
+}
+
+type sumEntry struct {
+	Digest string
+	File   string
+}
+
+func readSums(path string) ([]sumEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []sumEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		digest, file, ok := strings.Cut(line, "  ")
+		if !ok {
+			// binary-mode marker, "<digest> *<file>"
+			digest, file, ok = strings.Cut(line, " *")
+		}
+		if ok {
+			entries = append(entries, sumEntry{Digest: strings.ToLower(digest), File: file})
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// sumsMu serializes sums updates within the process; lockSums extends that to other processes.
+var sumsMu sync.Mutex
+
+// lockSums locks a sums file for a read-modify-write. Transcodes update the sums in the background while
+// the next title is finalized, and serve jobs may share an output directory. The lock is a hidden file
+// next to the sums file, since the sums file itself is replaced on every write.
+func lockSums(path string) (func(), error) {
+	sumsMu.Lock()
+	lock, err := lockFile(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock"), true)
+	if err != nil {
+		sumsMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile(lock)
+		sumsMu.Unlock()
+	}, nil
+}
+
+func upsertSum(path string, file string, digest string) error {
+	unlock, err := lockSums(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readSums(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	entries = filter(entries, func(e sumEntry) bool { return e.File != file })
+	entries = append(entries, sumEntry{Digest: digest, File: file})
+	return writeSums(path, entries)
+}
+
+// removeSum drops a file from a sums file, e.g. after its original was replaced by a transcode.
+func removeSum(path string, file string) error {
+	unlock, err := lockSums(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := readSums(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeSums(path, filter(entries, func(e sumEntry) bool { return e.File != file }))
+}
+
+// writeSums replaces a sums file through a temporary file of its own. Callers hold lockSums.
+func writeSums(path string, entries []sumEntry) error {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].File < entries[j].File })
+
+	var b strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s  %s\n", e.Digest, e.File)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// VerifyLibrary rechecks every file listed in the sums files under root.
+func VerifyLibrary(root string) error {
+	checked, failed := 0, 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		for name, algorithm := range hashAlgorithms {
+			if d.Name() != algorithm.SumsFile {
+				continue
+			}
+			entries, err := readSums(path)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				file := filepath.Join(filepath.Dir(path), e.File)
+				digest, err := digestFile(file, algorithm)
+				checked++
+				switch {
+				case err != nil:
+					failed++
+					fmt.Printf("MISSING  %s  (%s: %v)\n", file, name, err)
+				case digest != e.Digest:
+					failed++
+					fmt.Printf("FAILED   %s  (%s)\n", file, name)
+				default:
+					fmt.Printf("OK       %s  (%s)\n", file, name)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if checked == 0 {
+		return fmt.Errorf("no checksum manifests found under %s", root)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d file(s) failed verification", failed, checked)
+	}
+	fmt.Printf("✓ All %d file(s) verified.\n", checked)
+	return nil
+}
+
+func digestFile(path string, algorithm hashAlgorithm) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := algorithm.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	AudioMain        = "main"
+	AudioCommentary  = "commentary"
+	AudioDescriptive = "descriptive"
+	AudioMusic       = "music"
+)
+
+var audioClasses = []string{AudioMain, AudioCommentary, AudioDescriptive, AudioMusic}
+
+// classifyAudio assigns a class to every audio stream of a title.
+// makemkv's stream flags win, then description text naming the class; otherwise the first stream of a
+// language is the main track, and later low-bitrate stereo/mono lossy streams next to a multichannel main
+// track are taken as commentary.
+func classifyAudio(list []Audio) {
+	mainByLang := map[string]Audio{}
+	for i := range list {
+		a := &list[i]
+		lang := normalizeLang(a.LanguageCode)
+
+		if class := audioClassFromFlags(a.Flags); class != "" {
+			a.Class = class
+			continue
+		}
+		if class := audioClassFromText(a.Description + " " + a.LongDescription); class != "" {
+			a.Class = class
+			continue
+		}
+
+		main, hasMain := mainByLang[lang]
+		if !hasMain {
+			a.Class = AudioMain
+			mainByLang[lang] = *a
+			continue
+		}
+
+		codec := strings.Join([]string{a.CodecID, a.CodecShort, a.CodecLong}, " ")
+		bps := bitrateToBps(a.Bitrate)
+		if a.Channels <= 2 && main.Channels > 2 && !isLossless(codec) && (bps == 0 || bps <= 256000) {
+			a.Class = AudioCommentary
+			continue
+		}
+		a.Class = AudioMain
+	}
+}
+
+func audioClassFromFlags(flags int) string {
+	switch {
+	case flags&(FlagDirectorsComments|FlagAltDirectorsComments) != 0:
+		return AudioCommentary
+	case flags&FlagVisuallyImpaired != 0:
+		return AudioDescriptive
+	}
+	return ""
+}
+
+func audioClassFromText(text string) string {
+	t := strings.ToLower(text)
+	switch {
+	case strings.Contains(t, "commentary"):
+		return AudioCommentary
+	case strings.Contains(t, "descriptive"), strings.Contains(t, "description"), strings.Contains(t, "narrat"),
+		strings.Contains(t, "visually impaired"):
+		return AudioDescriptive
+	case strings.Contains(t, "music only"), strings.Contains(t, "isolated score"), strings.Contains(t, "score only"):
+		return AudioMusic
+	}
+	return ""
+}
+
+func audioClassTag(class string) string {
+	switch class {
+	case AudioCommentary:
+		return "Ⓒ"
+	case AudioDescriptive:
+		return "Ⓓ"
+	case AudioMusic:
+		return "♫"
+	default:
+		return ""
+	}
+}
+
+func validateAudioClasses(classes []string) {
+	for _, class := range classes {
+		if !slices.Contains(audioClasses, strings.ToLower(class)) {
+			fmt.Printf("Unknown audio class %q, expected one of: %s\n", class, strings.Join(audioClasses, ", "))
+			os.Exit(1)
+		}
+	}
+}
+
+// audioClassAllowed reports whether a profile keeps audio of the given class.
+func audioClassAllowed(profile Profile, class string) bool {
+	if class == "" {
+		class = AudioMain
+	}
+	if len(profile.AudioClasses) > 0 && !containsFold(profile.AudioClasses, class) {
+		return false
+	}
+	return !containsFold(profile.ExcludeAudio, class)
+}
+
+// SelectStreams evaluates a profile against a title: makemkv's selection string first,
+// then the audio classes makemkv cannot express.
+func SelectStreams(profile Profile, t Title, favlangs []string) map[int]bool {
+	kept := EvaluateSelection(CompileSelection(profile), t, favlangs)
+	for _, a := range t.Audio {
+		if !audioClassAllowed(profile, a.Class) {
+			kept[a.StreamID] = false
+		}
+	}
+	return kept
+}
+
+// dropExcludedAudio remuxes a ripped file without the audio streams makemkv kept but whose class the
+// profile excludes. Output track IDs follow the source order of the streams makemkv kept.
+func dropExcludedAudio(file string, t Title, profile Profile, config Config) error {
+	remuxed := file + ".remux.mkv"
+	argv := dropAudioArgs(file, remuxed, t, profile, config)
+	if argv == nil {
+		return nil
+	}
+	mkvmerge := exec.Command("mkvmerge", argv...)
+	if out, err := mkvmerge.CombinedOutput(); err != nil {
+		os.Remove(remuxed)
+		return fmt.Errorf("mkvmerge: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.Rename(remuxed, file)
+}
+
+// dropAudioArgs returns the mkvmerge arguments for dropExcludedAudio, nil when no audio is dropped.
+func dropAudioArgs(file string, remuxed string, t Title, profile Profile, config Config) []string {
+	ripped := EvaluateSelection(CompileSelection(profile), t, config.PreferredLanguages)
+	streams := titleStreams(t)
+	sort.Slice(streams, func(i, j int) bool { return streams[i].StreamID < streams[j].StreamID })
+
+	var drop []string
+	trackID := 0
+	for _, s := range streams {
+		if !ripped[s.StreamID] {
+			continue
+		}
+		if s.Kind == "audio" && !audioClassAllowed(profile, audioClass(t, s.StreamID)) {
+			drop = append(drop, strconv.Itoa(trackID))
+		}
+		trackID++
+	}
+	if len(drop) == 0 {
+		return nil
+	}
+	return []string{"-q", "-o", remuxed, "--audio-tracks", "!" + strings.Join(drop, ","), file}
+}
+
+func audioClass(t Title, streamID int) string {
+	for _, a := range t.Audio {
+		if a.StreamID == streamID {
+			return a.Class
+		}
+	}
+	return ""
+}
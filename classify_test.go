@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClassifyAudio(t *testing.T) {
+	truehd := Audio{CodecID: "A_TRUEHD", CodecLong: "Dolby TrueHD", LanguageCode: "eng", Channels: 6}
+	stereo := Audio{CodecID: "A_AC3", CodecLong: "Dolby Digital", LanguageCode: "eng", Channels: 2, Bitrate: "192 Kb/s"}
+	with := func(a Audio, change func(*Audio)) Audio {
+		change(&a)
+		return a
+	}
+
+	tests := []struct {
+		name  string
+		audio []Audio
+		want  []string
+	}{
+		{"first of a language is main", []Audio{truehd, with(stereo, func(a *Audio) { a.LanguageCode = "fra" })}, []string{AudioMain, AudioMain}},
+		{"low-bitrate stereo next to multichannel", []Audio{truehd, stereo}, []string{AudioMain, AudioCommentary}},
+		{"high-bitrate stereo next to multichannel", []Audio{truehd, with(stereo, func(a *Audio) { a.Bitrate = "640 Kb/s" })}, []string{AudioMain, AudioMain}},
+		{"lossless stereo next to multichannel", []Audio{truehd, with(stereo, func(a *Audio) { a.CodecID, a.CodecLong = "A_LPCM", "LPCM" })}, []string{AudioMain, AudioMain}},
+		{"stereo next to stereo", []Audio{stereo, stereo}, []string{AudioMain, AudioMain}},
+		{"commentary text", []Audio{truehd, with(truehd, func(a *Audio) { a.Description = "Director's Commentary" })}, []string{AudioMain, AudioCommentary}},
+		{"descriptive text", []Audio{with(stereo, func(a *Audio) { a.LongDescription = "Descriptive Audio" })}, []string{AudioDescriptive}},
+		{"music text", []Audio{truehd, with(stereo, func(a *Audio) { a.Description = "Isolated Score" })}, []string{AudioMain, AudioMusic}},
+		{"commentary flag", []Audio{truehd, with(truehd, func(a *Audio) { a.Flags = FlagDirectorsComments })}, []string{AudioMain, AudioCommentary}},
+		{"alternate commentary flag", []Audio{truehd, with(truehd, func(a *Audio) { a.Flags = FlagAltDirectorsComments })}, []string{AudioMain, AudioCommentary}},
+		{"visually impaired flag beats commentary text", []Audio{truehd, with(stereo, func(a *Audio) {
+			a.Flags, a.Description = FlagVisuallyImpaired, "Commentary"
+		})}, []string{AudioMain, AudioDescriptive}},
+		{"commentary flag beats descriptive text", []Audio{truehd, with(truehd, func(a *Audio) {
+			a.Flags, a.Description = FlagDirectorsComments, "Audio Description"
+		})}, []string{AudioMain, AudioCommentary}},
+		{"core flag is no class", []Audio{with(truehd, func(a *Audio) { a.Flags = FlagCoreAudio })}, []string{AudioMain}},
+		{"flagged stream does not become main", []Audio{with(stereo, func(a *Audio) { a.Flags = FlagVisuallyImpaired }), truehd, stereo}, []string{AudioDescriptive, AudioMain, AudioCommentary}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := append([]Audio(nil), tt.audio...)
+			classifyAudio(audio)
+			var got []string
+			for _, a := range audio {
+				got = append(got, a.Class)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("classes %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// classifiedTitle has main and MVC video, English main, commentary and second main audio, French
+// descriptive and main audio, and an English subtitle, classified the way a scan does.
+func classifiedTitle() Title {
+	t := Title{
+		Video: []Video{
+			{StreamID: 0, CodecID: "V_MPEG4/ISO/AVC", CodecShort: "Mpeg4"},
+			{StreamID: 1, CodecID: "V_MPEG4/ISO/MVC", CodecShort: "MVC"},
+		},
+		Audio: []Audio{
+			{StreamID: 2, CodecID: "A_TRUEHD", CodecLong: "Dolby TrueHD", Language: "English", LanguageCode: "eng", Channels: 6},
+			{StreamID: 3, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "English", LanguageCode: "eng", Channels: 2, Flags: FlagDirectorsComments},
+			{StreamID: 4, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "English", LanguageCode: "eng", Channels: 6},
+			{StreamID: 5, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "French", LanguageCode: "fra", Channels: 2, Flags: FlagVisuallyImpaired},
+			{StreamID: 6, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "French", LanguageCode: "fra", Channels: 6},
+		},
+		Subtitles: []Subtitles{
+			{StreamID: 7, CodecID: "S_HDMV/PGS", Language: "English", LanguageCode: "eng"},
+		},
+	}
+	classifyAudio(t.Audio)
+	classifySubtitles(t.Subtitles)
+	return t
+}
+
+func TestDropAudioArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    []string // --audio-tracks value, nil when nothing is dropped
+	}{
+		{"nothing excluded", Profile{}, nil},
+		{"commentary between kept tracks, mvc dropped before it", Profile{ExcludeAudio: []string{AudioCommentary}}, []string{"--audio-tracks", "!2"}},
+		{"commentary and descriptive", Profile{ExcludeAudio: []string{AudioCommentary, AudioDescriptive}}, []string{"--audio-tracks", "!2,4"}},
+		{"main only", Profile{AudioClasses: []string{AudioMain}}, []string{"--audio-tracks", "!2,4"}},
+		{"mvc kept before the audio", Profile{KeepMVC: true, ExcludeAudio: []string{AudioCommentary, AudioDescriptive}}, []string{"--audio-tracks", "!3,5"}},
+		{"streams makemkv dropped", Profile{Audio: []string{"fra"}, ExcludeAudio: []string{AudioDescriptive}}, []string{"--audio-tracks", "!1"}},
+		{"excluded class makemkv dropped", Profile{Audio: []string{"fra"}, ExcludeAudio: []string{AudioCommentary}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dropAudioArgs("in.mkv", "out.mkv", classifiedTitle(), tt.profile, Config{})
+			var want []string
+			if tt.want != nil {
+				want = append(append([]string{"-q", "-o", "out.mkv"}, tt.want...), "in.mkv")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("dropAudioArgs = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -18,8 +18,8 @@ const (
 	TiSizeHuman      = 10 // "920.1 MB"
 	TiSizeBytes      = 11 // "964829184"
 	TiPlaylist       = 16 // "00038.mpls" or source file
-	TiVideoTracks    = 25 // count
-	TiAudioTracks    = 26 // count
+	TiSegmentsCount  = 25 // count of source segments (m2ts/vob files)
+	TiSegmentsMap    = 26 // e.g. "1-3,5" or "00055,00056"
 	TiDefaultOutName = 27 // "Up (Disc 1)_t00.mkv"
 	TiLangCode       = 28 // "eng"
 	TiLangName       = 29 // "English"
@@ -43,7 +43,7 @@ const (
 	SiResolution    = 19 // "1920x1080"
 	SiAspectRatio   = 20 // "16:9"
 	SiFrameRate     = 21 // "23.976 (24000/1001)"
-	SiPgSizeOrFlg   = 22 // seen "0" / "6144" (PGS packet size/flag)
+	SiPgSizeOrFlg   = 22 // stream flags bitmask, e.g. "6144" = forced + derived (see Flag* constants)
 	SiLangCode2     = 28 // duplicate lang code
 	SiLangName2     = 29 // duplicate lang text
 	SiLongDesc      = 30 // "DD Surround 5.1 English"
@@ -54,3 +54,25 @@ const (
 	SiChannelLayout = 40 // "5.1(side)", "stereo"
 	SiNotes         = 42 // "( Lossless conversion )"
 )
+
+// SiPgSizeOrFlg stream flag bits
+const (
+	FlagDirectorsComments    = 1
+	FlagAltDirectorsComments = 2
+	FlagVisuallyImpaired     = 4
+	FlagCoreAudio            = 256
+	FlagSecondaryAudio       = 512
+	FlagHasCoreAudio         = 1024
+	FlagDerivedStream        = 2048
+	FlagForcedSubtitles      = 4096
+)
+
+// DRV drive states
+const (
+	DriveEmptyClosed = 0
+	DriveEmptyOpen   = 1
+	DriveInserted    = 2
+	DriveLoading     = 3
+	DriveNoDrive     = 256
+	DriveUnmounting  = 257
+)
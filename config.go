@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type Profile struct {
+	Audio    []string `json:"audio"`     // audio languages to keep, empty or "all" keeps every track
+	Subtitle []string `json:"subtitle"`  // subtitle languages to keep, empty or "all" keeps every track
+	NoLang   bool     `json:"nolang"`    // also keep audio/subtitles without a language tag
+	DropCore bool     `json:"drop_core"` // drop lossy core tracks when the lossless track is kept
+	KeepMVC  bool     `json:"keep_mvc"`  // keep the 3D MVC video stream
+	Rules    []string `json:"rules"`     // raw selection rules appended verbatim, e.g. "-sel:mono"
+
+	AudioClasses []string `json:"audio_classes"` // keep only audio of these classes, e.g. ["main"]
+	ExcludeAudio []string `json:"exclude_audio"` // drop audio of these classes, e.g. ["commentary", "descriptive"]
+}
+
+type VerifyConfig struct {
+	DurationSeconds float64 `json:"duration_seconds"` // allowed duration drift, 0 uses the default of 2s
+	Chapters        int     `json:"chapters"`         // allowed chapter count difference
+}
+
+type HooksConfig struct {
+	OnTitleDone []string `json:"on_title_done"` // shell commands run after each title is ripped and verified, and transcoded
+	OnDiscDone  []string `json:"on_disc_done"`  // shell commands run after the whole disc
+	OnFailure   []string `json:"on_failure"`    // shell commands run for each failed title, and once when the rip stops early
+}
+
+type TranscodePreset struct {
+	Tool      string   `json:"tool"`      // "ffmpeg" or "handbrake"
+	Args      []string `json:"args"`      // encoder arguments, e.g. ["--preset", "H.265 MKV 1080p30"] for HandBrakeCLI
+	Extension string   `json:"extension"` // output extension, default ".mkv"
+}
+
+// TranscodeRule picks a preset from the main video stream. Zero values match anything.
+type TranscodeRule struct {
+	MinHeight int    `json:"min_height"`
+	MaxHeight int    `json:"max_height"`
+	HDR       *bool  `json:"hdr"`
+	Preset    string `json:"preset"`
+}
+
+type TranscodeConfig struct {
+	Presets map[string]TranscodePreset `json:"presets"` // added to, or replacing, the built-in presets
+	Rules   []TranscodeRule            `json:"rules"`   // used by --transcode auto, first match wins
+	Jobs    int                        `json:"jobs"`    // concurrent transcodes, default 1
+	Policy  string                     `json:"policy"`  // "keep" (default) or "replace" the original
+}
+
+type OCRConfig struct {
+	// Command is the OCR engine's argv, each argument a Go template over .Input, .Output, .Lang and .Forced.
+	// Defaults to subtile-ocr.
+	Command []string `json:"command"`
+}
+
+type ServeConfig struct {
+	StateDir       string `json:"state_dir"`       // queue, job logs and locks, default ~/.config/ripmkv/serve
+	IOSlots        int    `json:"io_slots"`        // files post-processed and finalized at once across jobs, default 1
+	TranscodeSlots int    `json:"transcode_slots"` // transcodes at once across jobs, default 1
+	BackupWorkers  int    `json:"backup_workers"`  // jobs at once on file: and iso: sources, default 1
+}
+
+type WatchConfig struct {
+	Drives   []string `json:"drives"`   // devices to watch, e.g. ["/dev/sr0"], default every drive makemkvcon lists
+	Interval int      `json:"interval"` // seconds between polls of the drives, default 5
+	// Args are the ripmkv options each inserted disc is ripped with, e.g.
+	// ["--main", "-a", "eng", "-s", "eng", "-o", "/media/rips", "-y"].
+	Args []string `json:"args"`
+}
+
+type Config struct {
+	PreferredLanguages []string           `json:"preferred_languages"` // "favlang" of selection rules, e.g. ["eng"]
+	Profiles           map[string]Profile `json:"profiles"`
+	Verify             VerifyConfig       `json:"verify"`
+	Template           string             `json:"template"`      // default for --template
+	EpisodeOrder       map[string][]int   `json:"episode_order"` // per-disc episode order by volume label, e.g. {"SHOW_S2_D1": [4, 2, 3, 1]}
+	Hooks              HooksConfig        `json:"hooks"`
+	Transcode          TranscodeConfig    `json:"transcode"`
+	OCR                OCRConfig          `json:"ocr"`
+	Serve              ServeConfig        `json:"serve"`
+	Watch              WatchConfig        `json:"watch"`
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ripmkv", "config.json")
+}
+
+func serveStateDir(config Config) string {
+	if config.Serve.StateDir != "" {
+		return config.Serve.StateDir
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "ripmkv-serve")
+	}
+	return filepath.Join(dir, "ripmkv", "serve")
+}
+
+func LoadConfig(args Arguments) Config {
+	var config Config
+
+	path := args.Config
+	if path == "" {
+		path = defaultConfigPath()
+		if path == "" {
+			return config
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if args.Config == "" && errors.Is(err, fs.ErrNotExist) {
+			return config
+		}
+		fmt.Println("Failed to read config:", err)
+		os.Exit(1)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		fmt.Printf("Failed to parse config %s: %v\n", path, err)
+		os.Exit(1)
+	}
+
+	return config
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// --eject policies
+const (
+	EjectSuccess = "success" // after a successful rip
+	EjectAlways  = "always"  // after every rip, also when it failed
+	EjectNever   = "never"
+)
+
+// ejectDisc opens the tray of a drive with eject(1).
+func ejectDisc(device string) error {
+	cmd := exec.Command("eject", strings.TrimPrefix(device, "dev:"))
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("eject: %v: %s", err, strings.TrimSpace(errb.String()))
+	}
+	return nil
+}
+
+// ejectAfter ejects the disc of -d after a rip or backup that ended with err, as --eject asks. Backups
+// and images have nothing to eject.
+func ejectAfter(args Arguments, err error) {
+	source := discSource(args)
+	if !strings.HasPrefix(source, "dev:") {
+		return
+	}
+	if args.Eject == EjectAlways || (args.Eject == EjectSuccess && err == nil) {
+		fmt.Printf("Ejecting %s\n", strings.TrimPrefix(source, "dev:"))
+		if err := ejectDisc(source); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// envDriveLocked tells a ripmkv child process that its parent holds the lock of a drive for it, e.g. watch
+// for the rip it started. It holds the lock file path.
+const envDriveLocked = "RIPMKV_DRIVE_LOCKED"
+
+// discDevices caches the devices of makemkvcon's disc:<index> sources, which do not change while the
+// process runs.
+var (
+	discDevicesMu sync.Mutex
+	discDevices   = map[int]string{}
+)
+
+// discDevice returns the device of the drive makemkvcon numbers index.
+func discDevice(index int) (string, bool) {
+	discDevicesMu.Lock()
+	defer discDevicesMu.Unlock()
+	if device, ok := discDevices[index]; ok {
+		return device, true
+	}
+	drives, err := ListDrives()
+	if err != nil {
+		return "", false
+	}
+	for _, d := range drives {
+		discDevices[d.Index] = d.Device
+	}
+	device, ok := discDevices[index]
+	return device, ok
+}
+
+// driveLockPath returns the drive of a source and the path of its lock file. Backup folders and images have
+// no drive.
+func driveLockPath(source string) (string, string, bool) {
+	var device string
+	switch {
+	case strings.HasPrefix(source, "dev:"):
+		device = strings.TrimPrefix(source, "dev:")
+	case strings.HasPrefix(source, "disc:"):
+		// disc:0 is a drive makemkvcon also knows by its device.
+		device = source
+		if index, err := strconv.Atoi(strings.TrimPrefix(source, "disc:")); err == nil {
+			if resolved, ok := discDevice(index); ok {
+				device = resolved
+			}
+		}
+	default:
+		return "", "", false
+	}
+	// /dev/cdrom and /dev/sr0 are the same drive.
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(strings.TrimPrefix(device, "/"))
+	return device, filepath.Join(os.TempDir(), "ripmkv-drive-"+name+".lock"), true
+}
+
+// lockDrive keeps other ripmkv processes off a drive while it is scanned, ripped or ejected. The lock file
+// holds the pid and command of its owner, so a process finding the drive busy can say who has it. Backup
+// folders and images are not locked.
+func lockDrive(source string) (func(), error) {
+	device, path, ok := driveLockPath(source)
+	if !ok {
+		return func() {}, nil
+	}
+	if os.Getenv(envDriveLocked) == path {
+		// Processes this one starts, such as hooks, must take the lock themselves.
+		os.Unsetenv(envDriveLocked)
+		return func() {}, nil
+	}
+
+	f, err := lockFile(path, false)
+	if errors.Is(err, errLocked) {
+		owner, _ := os.ReadFile(path)
+		return nil, fmt.Errorf("drive %s is in use by another ripmkv process (%s)", device, strings.TrimSpace(string(owner)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Truncate(0)
+	fmt.Fprintf(f, "pid %d: %s\n", os.Getpid(), shellJoin(append([]string{"ripmkv"}, os.Args[1:]...)))
+	f.Sync()
+	return func() { unlockFile(f) }, nil
+}
+
+// Eject ejects the disc of -d, unless another ripmkv process is using the drive.
+func Eject(args Arguments) error {
+	if args.Drive == "" {
+		fmt.Println("Drive not specified. Use -d or --drive to specify the drive.")
+		printUsage()
+		os.Exit(1)
+	}
+	source := discSource(args)
+	if !strings.HasPrefix(source, "dev:") {
+		return fmt.Errorf("%s is not a drive", args.Drive)
+	}
+	release, err := lockDrive(source)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return ejectDisc(source)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	HookTitleDone = "on_title_done"
+	HookDiscDone  = "on_disc_done"
+	HookFailure   = "on_failure"
+)
+
+type hookDisc struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Volume  string `json:"volume"`
+	MakeMKV string `json:"makemkv,omitempty"`
+}
+
+type hookTitle struct {
+	Title      Title    `json:"title"`
+	Status     string   `json:"status"`
+	Output     string   `json:"output,omitempty"`
+	Transcoded string   `json:"transcoded,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Issues     []string `json:"issues,omitempty"`
+}
+
+// hookEvent is written as JSON to the hook's stdin. Title events carry one title, disc events all of them.
+// An on_failure event for a rip that stopped before its titles, e.g. on a scan failure, carries the source
+// and error instead of a title.
+type hookEvent struct {
+	Event  string      `json:"event"`
+	Disc   hookDisc    `json:"disc"`
+	Title  *hookTitle  `json:"title,omitempty"`
+	Titles []hookTitle `json:"titles,omitempty"`
+	OutDir string      `json:"outdir"`
+	Source string      `json:"source,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func newHookTitle(r ripResult) hookTitle {
+	h := hookTitle{Title: r.Title, Status: r.Status, Output: r.Output, Transcoded: r.Transcoded, Issues: r.Issues}
+	if r.Err != nil {
+		h.Error = r.Err.Error()
+	}
+	return h
+}
+
+func newHookEvent(event string, disc Disc, outDir string) hookEvent {
+	return hookEvent{
+		Event:  event,
+		Disc:   hookDisc{Name: disc.Name, Type: disc.Type, Volume: disc.Volume, MakeMKV: disc.MakeMKV},
+		OutDir: outDir,
+	}
+}
+
+// hookEnv exposes the most useful event fields as RIPMKV_* environment variables.
+func hookEnv(event hookEvent) []string {
+	env := []string{
+		"RIPMKV_EVENT=" + event.Event,
+		"RIPMKV_DISC_NAME=" + event.Disc.Name,
+		"RIPMKV_DISC_TYPE=" + event.Disc.Type,
+		"RIPMKV_DISC_VOLUME=" + event.Disc.Volume,
+		"RIPMKV_OUTDIR=" + event.OutDir,
+	}
+	if t := event.Title; t != nil {
+		env = append(env,
+			"RIPMKV_OUTPUT="+t.Output,
+			"RIPMKV_STATUS="+t.Status,
+			"RIPMKV_ERROR="+t.Error,
+			"RIPMKV_TITLE_ID="+strconv.Itoa(t.Title.ID),
+			"RIPMKV_TITLE_NAME="+t.Title.Name,
+			"RIPMKV_TITLE_DURATION="+t.Title.Duration,
+			"RIPMKV_TITLE_PLAYLIST="+t.Title.Playlist,
+			"RIPMKV_TITLE_CHAPTERS="+strconv.Itoa(t.Title.Chapters),
+		)
+	}
+	if event.Error != "" {
+		env = append(env,
+			"RIPMKV_SOURCE="+event.Source,
+			"RIPMKV_ERROR="+event.Error,
+		)
+	}
+	if event.Titles != nil {
+		var outputs []string
+		for _, t := range event.Titles {
+			if t.Output != "" {
+				outputs = append(outputs, t.Output)
+			}
+		}
+		env = append(env, "RIPMKV_OUTPUTS="+strings.Join(outputs, "\n"))
+	}
+	return env
+}
+
+// runTitleHooks runs the hooks of a title event, on_title_done or on_failure.
+func runTitleHooks(commands []string, event string, disc Disc, outDir string, result ripResult) []string {
+	e := newHookEvent(event, disc, outDir)
+	title := newHookTitle(result)
+	e.Title = &title
+	return runHooks(commands, e)
+}
+
+// runDiscFailureHooks runs the on_failure hooks for a rip that stopped before or between its titles, and
+// returns err. disc is empty when the rip stopped before the scan.
+func runDiscFailureHooks(config Config, disc Disc, args Arguments, err error) error {
+	event := newHookEvent(HookFailure, disc, args.OutDir)
+	event.Source = discSource(args)
+	event.Error = err.Error()
+	runHooks(config.Hooks.OnFailure, event)
+	return err
+}
+
+// runHooks runs each hook command through the shell and returns a message per failed hook.
+func runHooks(commands []string, event hookEvent) []string {
+	if len(commands) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %v", event.Event, err)}
+	}
+
+	var failures []string
+	for _, command := range commands {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(), hookEnv(event)...)
+		cmd.Stdin = bytes.NewReader(payload)
+		cmd.Stdout = os.Stdout
+		var errb bytes.Buffer
+		cmd.Stderr = &errb
+		if err := cmd.Run(); err != nil {
+			failure := fmt.Sprintf("%s hook %q: %v", event.Event, command, err)
+			if msg := strings.TrimSpace(errb.String()); msg != "" {
+				failure += ": " + msg
+			}
+			fmt.Println(failure)
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
@@ -0,0 +1,69 @@
+package main
+
+// ISO 639-2/B codes and their 639-2/T equivalents. Discs and mkvtoolnix don't agree on which one to use.
+var bibliographicLangs = map[string]string{
+	"alb": "sqi",
+	"arm": "hye",
+	"baq": "eus",
+	"bur": "mya",
+	"chi": "zho",
+	"cze": "ces",
+	"dut": "nld",
+	"fre": "fra",
+	"geo": "kat",
+	"ger": "deu",
+	"gre": "ell",
+	"ice": "isl",
+	"mac": "mkd",
+	"mao": "mri",
+	"may": "msa",
+	"per": "fas",
+	"rum": "ron",
+	"slo": "slk",
+	"tib": "bod",
+	"wel": "cym",
+}
+
+// terminologyLang returns the ISO 639-2/T form of a language code.
+func terminologyLang(code string) string {
+	code = normalizeLang(code)
+	if t, ok := bibliographicLangs[code]; ok {
+		return t
+	}
+	return code
+}
+
+func sameLang(a, b string) bool {
+	return terminologyLang(a) == terminologyLang(b)
+}
+
+// ISO 639-2/T codes with an ISO 639-1 equivalent, for BCP 47 language-ietf tags.
+var twoLetterLangs = map[string]string{
+	"ara": "ar", "bul": "bg", "cat": "ca", "ces": "cs", "cym": "cy", "dan": "da", "deu": "de", "ell": "el",
+	"eng": "en", "est": "et", "eus": "eu", "fas": "fa", "fin": "fi", "fra": "fr", "gle": "ga", "glg": "gl",
+	"heb": "he", "hin": "hi", "hrv": "hr", "hun": "hu", "hye": "hy", "ind": "id", "isl": "is", "ita": "it",
+	"jpn": "ja", "kat": "ka", "kor": "ko", "lav": "lv", "lit": "lt", "mkd": "mk", "msa": "ms", "nld": "nl",
+	"nob": "nb", "nor": "no", "pol": "pl", "por": "pt", "ron": "ro", "rus": "ru", "slk": "sk", "slv": "sl",
+	"spa": "es", "sqi": "sq", "srp": "sr", "swe": "sv", "tam": "ta", "tel": "te", "tha": "th", "tur": "tr",
+	"ukr": "uk", "urd": "ur", "vie": "vi", "zho": "zh",
+}
+
+// matroskaLang returns the ISO 639-2/B code Matroska's legacy language element expects.
+func matroskaLang(code string) string {
+	t := terminologyLang(code)
+	for b, term := range bibliographicLangs {
+		if term == t {
+			return b
+		}
+	}
+	return t
+}
+
+// ietfLang returns the BCP 47 tag for a language code, e.g. "fre" -> "fr".
+func ietfLang(code string) string {
+	t := terminologyLang(code)
+	if two, ok := twoLetterLangs[t]; ok {
+		return two
+	}
+	return t
+}
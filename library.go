@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Plex/Jellyfin extras folders, keyed by the kind used with --assign.
+var extrasFolders = map[string]string{
+	"behindthescenes": "Behind The Scenes",
+	"deleted":         "Deleted Scenes",
+	"featurette":      "Featurettes",
+	"interview":       "Interviews",
+	"scene":           "Scenes",
+	"short":           "Shorts",
+	"trailer":         "Trailers",
+	"other":           "Other",
+}
+
+var extrasLabels = map[string]string{
+	"behindthescenes": "Behind The Scenes",
+	"deleted":         "Deleted Scene",
+	"featurette":      "Featurette",
+	"interview":       "Interview",
+	"scene":           "Scene",
+	"short":           "Short",
+	"trailer":         "Trailer",
+	"other":           "Extra",
+}
+
+// parseAssignments parses --assign values of the form <track>=<kind>.
+func parseAssignments(values []string) map[int]string {
+	assignments := map[int]string{}
+	for _, value := range values {
+		id, kind, ok := strings.Cut(value, "=")
+		n, err := strconv.Atoi(id)
+		kind = strings.ToLower(strings.ReplaceAll(kind, " ", ""))
+		if _, known := extrasFolders[kind]; !ok || err != nil || (!known && kind != "main") {
+			kinds := make([]string, 0, len(extrasFolders))
+			for k := range extrasFolders {
+				kinds = append(kinds, k)
+			}
+			sort.Strings(kinds)
+			fmt.Printf("Invalid assignment %q, expected <track>=<kind> with kind one of: main, %s\n", value, strings.Join(kinds, ", "))
+			os.Exit(1)
+		}
+		assignments[n] = kind
+	}
+	return assignments
+}
+
+// classifyMovieTitles decides which title is the main feature and which extras folder every other title goes to.
+// Explicit assignments win; otherwise the longest title is the main feature, titles under 4 minutes are
+// trailers and everything else is a featurette.
+func classifyMovieTitles(titles []Title, assignments map[int]string) map[int]string {
+	kinds := map[int]string{}
+	mainID := -1
+	for id, kind := range assignments {
+		if kind == "main" {
+			mainID = id
+		}
+	}
+	if mainID < 0 {
+		var longest int64 = -1
+		for _, t := range titles {
+			if _, assigned := assignments[t.ID]; assigned {
+				continue
+			}
+			if seconds := durationSeconds(t.Duration); seconds > longest {
+				longest, mainID = seconds, t.ID
+			}
+		}
+	}
+
+	for _, t := range titles {
+		switch kind, assigned := assignments[t.ID]; {
+		case t.ID == mainID:
+			kinds[t.ID] = "main"
+		case assigned:
+			kinds[t.ID] = kind
+		case durationSeconds(t.Duration) < 4*60:
+			kinds[t.ID] = "trailer"
+		default:
+			kinds[t.ID] = "featurette"
+		}
+	}
+	return kinds
+}
+
+// movieLibraryPath returns the path below the library root for a title:
+// "Name (Year)/Name (Year) {edition-X}.mkv" for the main feature, "Name (Year)/<Extras>/..." otherwise.
+func movieLibraryPath(data nameData, kind string, edition string) string {
+	movie := data.Name
+	if data.Year != "" {
+		movie = fmt.Sprintf("%s (%s)", data.Name, data.Year)
+	}
+	folder := sanitizeFilename(movie)
+
+	if kind == "main" {
+		file := movie
+		if edition != "" {
+			file += " {edition-" + edition + "}"
+		}
+		return filepath.Join(folder, sanitizeFilename(file)+".mkv")
+	}
+	file := fmt.Sprintf("%s - %s %s.mkv", movie, extrasLabels[kind], data.ID)
+	return filepath.Join(folder, extrasFolders[kind], sanitizeFilename(file))
+}
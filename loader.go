@@ -2,17 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Video struct {
+	StreamID   int
 	CodecID    string
 	CodecShort string
 	CodecLong  string
@@ -20,29 +23,39 @@ type Video struct {
 	Resolution string
 	Aspect     string
 	FrameRate  string
+	HDR        bool
 }
 
 type Audio struct {
-	CodecID       string
-	CodecShort    string
-	CodecLong     string
-	Language      string
-	LanguageCode  string
-	Description   string
-	Channels      int
-	Layout        string
-	SampleRate    int
-	BitsPerSample int
-	Default       bool
+	StreamID        int
+	CodecID         string
+	CodecShort      string
+	CodecLong       string
+	Language        string
+	LanguageCode    string
+	Description     string
+	LongDescription string
+	Class           string // main | commentary | descriptive | music
+	Flags           int    // SiPgSizeOrFlg bits, e.g. FlagDirectorsComments
+	Bitrate         string
+	Channels        int
+	Layout          string
+	SampleRate      int
+	BitsPerSample   int
+	Default         bool
 }
 
 type Subtitles struct {
+	StreamID     int
 	CodecID      string
 	CodecShort   string
 	CodecLong    string
 	Language     string
 	LanguageCode string
 	Description  string
+	Flags        int
+	Forced       bool
+	SDH          bool
 	Default      bool
 }
 
@@ -52,6 +65,8 @@ type Title struct {
 	Chapters  int
 	Duration  string
 	Playlist  string
+	Segments  string
+	OutName   string // makemkvcon's output file name, e.g. "Up_t00.mkv"
 	Bytes     int64
 	Size      string
 	Video     []Video
@@ -60,10 +75,11 @@ type Title struct {
 }
 
 type Disc struct {
-	Type   string
-	Name   string
-	Volume string
-	Titles []Title
+	Type    string
+	Name    string
+	Volume  string
+	MakeMKV string // makemkvcon version that scanned the disc
+	Titles  []Title
 }
 
 func buildTitles(tracks map[int]Track, streams map[int]map[int]Stream) []Title {
@@ -75,12 +91,21 @@ func buildTitles(tracks map[int]Track, streams map[int]map[int]Stream) []Title {
 		title.Chapters = track.Chapters
 		title.Duration = track.Duration
 		title.Playlist = track.Playlist
+		title.Segments = track.SegmentsMap
+		title.OutName = track.DefaultOut
 		title.Bytes = track.SizeBytes
 		title.Size = track.SizeHuman
-		for _, stream := range streams[trackID] {
+		streamIDs := make([]int, 0, len(streams[trackID]))
+		for streamID := range streams[trackID] {
+			streamIDs = append(streamIDs, streamID)
+		}
+		slices.Sort(streamIDs)
+		for _, streamID := range streamIDs {
+			stream := streams[trackID][streamID]
 			switch stream.TypeName {
 			case "Video":
 				video := Video{}
+				video.StreamID = stream.StreamID
 				video.CodecID = stream.CodecID
 				video.CodecShort = stream.CodecShort
 				video.CodecLong = stream.CodecLong
@@ -88,15 +113,20 @@ func buildTitles(tracks map[int]Track, streams map[int]map[int]Stream) []Title {
 				video.Resolution = stream.Resolution
 				video.Aspect = stream.AspectRatio
 				video.FrameRate = stream.FrameRate
+				video.HDR = isHDR(stream)
 				title.Video = append(title.Video, video)
 			case "Audio":
 				audio := Audio{}
+				audio.StreamID = stream.StreamID
 				audio.CodecID = stream.CodecID
 				audio.CodecShort = stream.CodecShort
 				audio.CodecLong = stream.CodecLong
 				audio.Language = stream.LangName
 				audio.LanguageCode = stream.LangCode
 				audio.Description = stream.Attr
+				audio.LongDescription = stream.LongDesc
+				audio.Flags = atoi(stream.PgSizeOrFlag)
+				audio.Bitrate = stream.Bitrate
 				audio.Channels = stream.Channels
 				audio.Layout = stream.ChannelLayout
 				audio.SampleRate = stream.SampleRate
@@ -105,42 +135,103 @@ func buildTitles(tracks map[int]Track, streams map[int]map[int]Stream) []Title {
 				title.Audio = append(title.Audio, audio)
 			case "Subtitles":
 				subtitles := Subtitles{}
+				subtitles.StreamID = stream.StreamID
 				subtitles.CodecID = stream.CodecID
 				subtitles.CodecShort = stream.CodecShort
 				subtitles.CodecLong = stream.CodecLong
 				subtitles.Language = stream.LangName
 				subtitles.LanguageCode = stream.LangCode
 				subtitles.Description = stream.LongDesc
+				subtitles.Flags = atoi(stream.PgSizeOrFlag)
 				subtitles.Default = stream.DefaultFlag
 				title.Subtitles = append(title.Subtitles, subtitles)
 			}
 		}
+		classifyAudio(title.Audio)
+		classifySubtitles(title.Subtitles)
 		titles = append(titles, title)
 	}
 	return titles
 }
 
+func findTitle(disc Disc, id int) (Title, bool) {
+	for _, t := range disc.Titles {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Title{}, false
+}
+
+// discSource returns the makemkvcon source for -d. Explicit dev:, disc:, file: and iso: sources pass
+// through; otherwise a directory is a backup folder, an .iso file an image, and anything else a drive.
+func discSource(args Arguments) string {
+	for _, prefix := range []string{"dev:", "disc:", "file:", "iso:"} {
+		if strings.HasPrefix(args.Drive, prefix) {
+			return args.Drive
+		}
+	}
+	if info, err := os.Stat(args.Drive); err == nil {
+		switch {
+		case info.IsDir():
+			return "file:" + args.Drive
+		case info.Mode().IsRegular() && strings.EqualFold(filepath.Ext(args.Drive), ".iso"):
+			return "iso:" + args.Drive
+		}
+	}
+	return "dev:" + args.Drive
+}
+
+// LoadDisc scans the drive with makemkvcon, or reads a saved "makemkvcon -r info" output given with --info.
 func LoadDisc(args Arguments) Disc {
+	if args.InfoFile != "" {
+		data, err := os.ReadFile(args.InfoFile)
+		if err != nil {
+			fmt.Println("Failed to read info file:", err)
+			os.Exit(1)
+		}
+		return ParseDisc(string(data))
+	}
+
 	if args.Drive == "" {
 		fmt.Println("Drive not specified. Use -d or --drive to specify the drive.")
 		printUsage()
 		os.Exit(1)
 	}
 
+	release, err := lockDrive(discSource(args))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	disc, err := ScanDisc(args)
+	release()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return disc
+}
+
+// ScanDisc runs "makemkvcon -r info" on the source of -d.
+func ScanDisc(args Arguments) (Disc, error) {
 	var argv []string
 	argv = append(argv, "-r")
 	argv = append(argv, "info")
-	argv = append(argv, "dev:"+args.Drive)
+	argv = append(argv, discSource(args))
 	cmd := exec.Command("makemkvcon", argv...)
 
 	var output, errb bytes.Buffer
 	cmd.Stdout, cmd.Stderr = &output, &errb
 	if err := cmd.Run(); err != nil {
-		fmt.Println(errb)
-		os.Exit(1)
+		return Disc{}, fmt.Errorf("makemkvcon: %v: %s", err, strings.TrimSpace(errb.String()))
 	}
 
-	cinfo, tinfo, sinfo := Tokenize(output.String())
+	return ParseDisc(output.String()), nil
+}
+
+func ParseDisc(output string) Disc {
+	cinfo, tinfo, sinfo := Tokenize(output)
 	container := ParseCInfo(cinfo)
 	tracks := ParseTInfo(tinfo)
 	streams := ParseSInfo(sinfo)
@@ -149,105 +240,413 @@ func LoadDisc(args Arguments) Disc {
 	disc.Type = container.DiscType
 	disc.Name = container.DiscName
 	disc.Volume = container.VolumeLabel
+	disc.MakeMKV = MakeMKVVersion(output)
 	disc.Titles = buildTitles(tracks, streams)
 
 	return disc
 }
 
-func RipDisc(args Arguments) {
-	if args.Drive == "" {
+type ripResult struct {
+	Title      Title
+	Status     string // done | skipped | mismatch | failed | cancelled
+	Output     string
+	Issues     []string // verification mismatches
+	Warnings   []string // post-processing, transcode and hook failures
+	Transcoded string   // transcoded output, "" when the title was not transcoded
+	Err        error
+}
+
+// validateRipArgs exits on missing or conflicting rip options. With --library the output directory
+// becomes the library root.
+func validateRipArgs(args Arguments) Arguments {
+	if args.Drive == "" && !(args.DryRun && args.InfoFile != "") {
 		fmt.Println("Drive not specified. Use -d or --drive to specify the drive.")
 		printUsage()
 		os.Exit(1)
 	}
+	if args.Library != "" {
+		if args.Library != "movies" {
+			fmt.Printf("Unknown library type %q, expected movies.\n", args.Library)
+			os.Exit(1)
+		}
+		if args.Root == "" {
+			fmt.Println("Library root not specified. Use --root to specify the library root.")
+			printUsage()
+			os.Exit(1)
+		}
+		args.OutDir = args.Root
+	}
+	if args.Series != "" && args.Season <= 0 {
+		fmt.Println("Season not specified. Use --season with --series.")
+		printUsage()
+		os.Exit(1)
+	}
 	if args.OutDir == "" {
 		fmt.Println("Output directory not specified. Use -o or --outdir to specify the output directory.")
 		printUsage()
 		os.Exit(1)
 	}
+	return args
+}
+
+// makemkvOptions returns the makemkvcon arguments shared by every title, up to the source. The selection
+// always goes through the profile, so makemkvcon keeps exactly the streams the later steps expect.
+// --minlength is left out: makemkvcon numbers titles after that filter, and the title IDs come from a
+// scan without it. selectedTitles applies --minlength instead.
+func makemkvOptions(profilePath string) []string {
+	var options []string
+	options = append(options, "mkv")
+	options = append(options, "--progress")
+	options = append(options, "--noscan")
+	options = append(options, "--directio=true")
+	options = append(options, "--profile="+profilePath)
+	return options
+}
+
+func RipDisc(ctx context.Context, args Arguments, config Config) ([]ripResult, error) {
+	args = validateRipArgs(args)
+
+	release, err := lockDrive(discSource(args))
+	if err != nil {
+		return nil, runDiscFailureHooks(config, Disc{}, args, err)
+	}
+	defer release()
+
+	disc, err := ScanDisc(args)
+	if err != nil {
+		runDiscFailureHooks(config, disc, args, err)
+		ejectAfter(args, err)
+		return nil, err
+	}
+	results, err := ripScannedDisc(ctx, disc, args, config)
+	ejectAfter(args, err)
+	return results, err
+}
+
+// ripScannedDisc rips the selected titles of a disc that was already scanned.
+func ripScannedDisc(ctx context.Context, disc Disc, args Arguments, config Config) ([]ripResult, error) {
+	// Title failures run their own on_failure hooks, a rip stopping before or between titles runs them here.
+	failed := func(err error) ([]ripResult, error) {
+		return nil, runDiscFailureHooks(config, disc, args, err)
+	}
+
+	if err := checkPreflight(disc, args, config); err != nil {
+		return failed(err)
+	}
 
 	if err := os.MkdirAll(args.OutDir, 0o755); err != nil {
-		fmt.Println("Failed to create output directory:", err)
-		os.Exit(1)
+		return failed(fmt.Errorf("failed to create output directory: %w", err))
 	}
 
-	var argv []string
-	argv = append(argv, "mkv")
-	argv = append(argv, "--progress")
-	argv = append(argv, "--noscan")
-	argv = append(argv, "--directio=true")
-	if (args.MinLength != "") && (args.MinLength != "0") {
-		argv = append(argv, "--minlength="+args.MinLength)
+	titles := selectedTitles(disc, args)
+	if len(titles) == 0 {
+		fmt.Println("No titles selected. Nothing to do.")
+		return nil, nil
 	}
-	if (args.Audio != nil) && (len(args.Audio) > 0) {
-		argv = append(argv, "--audio="+fmt.Sprintf("%s", strings.Join(args.Audio, ",")))
+
+	// Stage inside the output directory so finalizing is a rename on the same filesystem.
+	// The leading dot keeps media servers from indexing the staging area.
+	tmpDir, err := os.MkdirTemp(args.OutDir, ".ripmkv-*")
+	if err != nil {
+		return failed(fmt.Errorf("error creating staging directory: %w", err))
 	}
-	if (args.Subtitle != nil) && (len(args.Subtitle) > 0) {
-		argv = append(argv, "--subtitle="+fmt.Sprintf("%s", strings.Join(args.Subtitle, ",")))
+	defer os.RemoveAll(tmpDir)
+
+	manifest, err := LoadManifest(args.OutDir, disc)
+	if err != nil {
+		return failed(fmt.Errorf("error reading manifest: %w", err))
 	}
-	if args.Drive != "" {
-		argv = append(argv, "dev:"+args.Drive)
+
+	_, profile := ResolveProfile(args, config)
+	validateTranscode(args, config)
+	chapterTemplate(args.ChapterTemplate)
+	if args.ChapterNames != "" {
+		readChapterNames(args.ChapterNames)
 	}
-	if (args.Tracks != nil) && (len(args.Tracks) > 0) {
-		for _, track := range args.Tracks {
-			argv = append(argv, strconv.FormatInt(track, 10))
-		}
-	} else {
-		argv = append(argv, "all")
+
+	name, err := outputNamer(args, config, disc, titles)
+	if err != nil {
+		return failed(err)
+	}
+	if err := checkOutputPaths(titles, name, manifest); err != nil {
+		return failed(err)
 	}
 
-	tmpDir, err := os.MkdirTemp("", "*")
+	profilePath, err := writeMakeMKVProfile(tmpDir, CompileSelection(profile))
 	if err != nil {
-		fmt.Println("Error creating temporary directory:", err)
-		os.Exit(1)
+		return failed(fmt.Errorf("error writing selection profile: %w", err))
 	}
-	argv = append(argv, tmpDir)
+	options := makemkvOptions(profilePath)
 
-	cmd := exec.Command("makemkvcon", argv...)
+	transcodes := newTranscoder(ctx, args, config)
+
+	var results []ripResult
+	hookFailures := 0
+	for _, t := range titles {
+		if ctx.Err() != nil {
+			results = append(results, ripResult{Title: t, Status: "cancelled"})
+			continue
+		}
+		if args.Resume {
+			if entry, ok := manifest.Completed(t); ok {
+				fmt.Printf("Title %02d already ripped to %s, skipping.\n", t.ID, entry.Output)
+				results = append(results, ripResult{Title: t, Status: "skipped", Output: entry.Output})
+				continue
+			}
+		}
+
+		if err := manifest.Update(t, "ripping", "", nil); err != nil {
+			return failed(fmt.Errorf("error writing manifest: %w", err))
+		}
+		result := ripTitle(ctx, t, disc, args, config, profile, name, manifest, options, tmpDir)
+		switch {
+		case ctx.Err() != nil:
+			result.Status, result.Err = "cancelled", ctx.Err()
+		case result.Status == "failed":
+			fmt.Printf("Title %02d failed: %v\n", t.ID, result.Err)
+		}
+		// A mismatched file is not the title's output, the manifest keeps any earlier one.
+		output := result.Output
+		if result.Status == "mismatch" {
+			output = ""
+		}
+		if err := manifest.Update(t, result.Status, output, result.Err); err != nil {
+			fmt.Println("Error writing manifest:", err)
+		}
+
+		var failures []string
+		switch result.Status {
+		case "done":
+			// A transcoded title's hooks wait for the transcode, which reads the output the hooks may move.
+			if transcodes == nil || !transcodes.Submit(t, result.Output) {
+				failures = runTitleHooks(config.Hooks.OnTitleDone, HookTitleDone, disc, args.OutDir, result)
+			}
+		case "failed", "mismatch":
+			failures = runTitleHooks(config.Hooks.OnFailure, HookFailure, disc, args.OutDir, result)
+		}
+		hookFailures += len(failures)
+		result.Warnings = append(result.Warnings, failures...)
+		results = append(results, result)
+	}
+
+	transcodeFailures := 0
+	if transcodes != nil {
+		transcoded := transcodes.Wait()
+		for i, r := range results {
+			tr, ok := transcoded[r.Title.ID]
+			if !ok {
+				continue
+			}
+			if tr.Err != nil {
+				transcodeFailures++
+				results[i].Warnings = append(results[i].Warnings, fmt.Sprintf("Transcode with %s failed: %v", tr.Preset, tr.Err))
+			}
+			results[i].Transcoded = tr.Output
+			if tr.Output != "" && transcodePolicy(args, config) == "replace" {
+				results[i].Output = tr.Output
+				if err := manifest.Update(r.Title, r.Status, tr.Output, nil); err != nil {
+					fmt.Println("Error writing manifest:", err)
+				}
+			}
+			failures := runTitleHooks(config.Hooks.OnTitleDone, HookTitleDone, disc, args.OutDir, results[i])
+			hookFailures += len(failures)
+			results[i].Warnings = append(results[i].Warnings, failures...)
+		}
+	}
+
+	event := newHookEvent(HookDiscDone, disc, args.OutDir)
+	for _, r := range results {
+		event.Titles = append(event.Titles, newHookTitle(r))
+	}
+	discHookFailures := runHooks(config.Hooks.OnDiscDone, event)
+	hookFailures += len(discHookFailures)
+
+	printRipSummary(results, discHookFailures, args.OutDir)
+
+	if ctx.Err() != nil {
+		return results, errors.New("rip cancelled")
+	}
+	if failed := len(filter(results, func(r ripResult) bool { return r.Status == "failed" })); failed > 0 {
+		return results, fmt.Errorf("%d title(s) failed", failed)
+	}
+	if mismatched := len(filter(results, func(r ripResult) bool { return r.Status == "mismatch" })); mismatched > 0 {
+		return results, fmt.Errorf("%d title(s) failed verification", mismatched)
+	}
+	if transcodeFailures > 0 {
+		return results, fmt.Errorf("%d transcode(s) failed", transcodeFailures)
+	}
+	if hookFailures > 0 {
+		return results, fmt.Errorf("%d hook(s) failed", hookFailures)
+	}
+	return results, nil
+}
+
+// ripTitle rips a single title into its own staging directory, post-processes and verifies it, and moves
+// it into the output directory. A file that does not match the disc is kept out of the library as
+// <output>.mismatch, which media servers do not index, without checksums or sidecars. On cancellation makemkvcon is interrupted, waited for, and its partial output removed.
+// Each title is a makemkvcon run of its own, which opens the disc again every time: a few seconds for a
+// DVD, up to a minute for a Blu-ray with many playlists. That is the cost of per-title staging, resume
+// and cancellation.
+func ripTitle(ctx context.Context, t Title, disc Disc, args Arguments, config Config, profile Profile, name namer, manifest *Manifest, options []string, tmpDir string) ripResult {
+	var warnings []string
+	failed := func(err error) ripResult {
+		return ripResult{Title: t, Status: "failed", Warnings: warnings, Err: err}
+	}
+	warn := func(format string, a ...any) {
+		msg := fmt.Sprintf(format, a...)
+		fmt.Println(msg)
+		warnings = append(warnings, msg)
+	}
+
+	titleDir := filepath.Join(tmpDir, fmt.Sprintf("t%02d", t.ID))
+	if err := os.MkdirAll(titleDir, 0o755); err != nil {
+		return failed(err)
+	}
+	defer os.RemoveAll(titleDir)
+
+	argv := append([]string(nil), options...)
+	argv = append(argv, discSource(args))
+	argv = append(argv, strconv.Itoa(t.ID))
+	argv = append(argv, titleDir)
+
+	cmd := exec.CommandContext(ctx, "makemkvcon", argv...)
+	cmd.Cancel = func() error {
+		fmt.Println("Interrupted. Stopping makemkvcon and waiting for it to release the drive...")
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 30 * time.Second
 
 	var errb bytes.Buffer
 	cmd.Stderr = &errb
 	cmd.Stdout = os.Stdout
 	if err := cmd.Run(); err != nil {
-		fmt.Println(errb)
-		os.Exit(1)
+		if ctx.Err() != nil {
+			return failed(ctx.Err())
+		}
+		return failed(fmt.Errorf("makemkvcon: %v: %s", err, strings.TrimSpace(errb.String())))
 	}
 
-	glob := filepath.Join(tmpDir, "*.mkv")
-	files, err := filepath.Glob(glob)
+	files, err := filepath.Glob(filepath.Join(titleDir, "*.mkv"))
 	if err != nil {
-		fmt.Println("Error reading temporary directory:", err)
-		os.Exit(1)
+		return failed(fmt.Errorf("error reading staging directory: %w", err))
 	}
 	if files == nil {
-		fmt.Println("No MKVs produced. Nothing to do.")
-		os.Exit(0)
-	}
-	slices.Sort(files)
-
-	regex := regexp.MustCompile(`^.*?(?P<id>\d+)\.mkv$`)
-	for _, file := range files {
-		if args.Name != "" {
-			mkvpropedit := exec.Command("mkvpropedit", file, "--edit", "info", "--set", "title="+args.Name)
-			err := mkvpropedit.Run()
-			if err != nil {
-				fmt.Printf("mkvpropedit failed for %s\n", file)
-			}
+		return failed(errors.New("no MKV produced"))
+	}
+	file := files[0]
+
+	release, err := acquireSlot(ctx, SlotIO)
+	if err != nil {
+		return failed(err)
+	}
+	defer release()
+
+	if err := dropExcludedAudio(file, t, profile, config); err != nil {
+		warn("Failed to drop excluded audio from %s: %v", file, err)
+	}
+	if err := applyTrackProperties(file, t, profile, config); err != nil {
+		warn("Failed to set track properties on %s: %v", file, err)
+	}
+
+	if args.Name != "" {
+		mkvpropedit := exec.Command("mkvpropedit", file, "--edit", "info", "--set", "title="+args.Name)
+		err := mkvpropedit.Run()
+		if err != nil {
+			warn("mkvpropedit failed for %s", file)
 		}
+	}
 
-		base := filepath.Base(file)
-		matches := regex.FindStringSubmatch(base)
-		trackID := ""
-		if matches != nil {
-			trackID = "_" + matches[1]
+	if err := applyProvenanceTags(file, disc, t, titleDir); err != nil {
+		warn("Failed to write provenance tags to %s: %v", file, err)
+	}
+
+	var chapters []Chapter
+	if args.ChapterNames != "" || args.ChapterTemplate != "" || args.ExportChapters {
+		if chapters, err = processChapters(file, t, args, config, titleDir); err != nil {
+			warn("Failed to process chapters of %s: %v", file, err)
 		}
+	}
 
-		dest := filepath.Join(args.OutDir, fmt.Sprintf("%s%s.mkv", args.Name, trackID))
-		fmt.Printf("→ %s  ==>  %s\n", base, filepath.Base(dest))
-		if err = copyFile(file, dest); err != nil {
-			fmt.Println("Error renaming file:", err)
+	kept := SelectStreams(profile, t, config.PreferredLanguages)
+	issues := VerifyOutput(file, t, kept, config.Verify)
+
+	dest, err := name(t)
+	if err != nil {
+		return failed(fmt.Errorf("error naming output: %w", err))
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return failed(fmt.Errorf("error creating output directory: %w", err))
+	}
+	replace := earlierRip(dest, t, manifest)
+	hashes := newFileHashes(hashNames(args.Hash))
+	tee := hashes.Writer()
+	if len(issues) > 0 {
+		dest += ".mismatch"
+		replace, tee = true, nil
+	}
+	fmt.Printf("→ %s  ==>  %s\n", filepath.Base(file), dest)
+	// The paths were checked before the rip, but another rip may have written dest since.
+	if err = moveFile(file, dest, replace, tee); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return failed(fmt.Errorf("%s appeared while ripping and is not an earlier rip of this title, refusing to replace it", dest))
 		}
+		return failed(fmt.Errorf("error finalizing file: %w", err))
+	}
+	if len(issues) > 0 {
+		return ripResult{Title: t, Status: "mismatch", Output: dest, Issues: issues, Warnings: warnings, Err: errors.New(strings.Join(issues, "; "))}
 	}
+	os.Remove(dest + ".mismatch")
 
-	fmt.Printf("✓ Done. Wrote %d file(s) to: %s\n", len(files), args.OutDir)
+	if err = hashes.Record(dest); err != nil {
+		return failed(fmt.Errorf("error writing checksums: %w", err))
+	}
+	if args.ExportChapters && len(chapters) > 0 {
+		if err := exportChapters(dest, chapters, config); err != nil {
+			warn("Failed to export chapters of %s: %v", dest, err)
+		}
+	}
+	if args.ExportSubs {
+		if _, err := exportSubtitles(dest, t, profile, args.OCR, config); err != nil {
+			warn("Failed to export subtitles of %s: %v", dest, err)
+		}
+	}
+
+	return ripResult{Title: t, Status: "done", Output: dest, Warnings: warnings}
+}
+
+func printRipSummary(results []ripResult, hookFailures []string, outDir string) {
+	done := filter(results, func(r ripResult) bool { return r.Status == "done" || r.Status == "skipped" })
+
+	fmt.Println()
+	for _, r := range results {
+		switch r.Status {
+		case "done":
+			fmt.Printf("  ✓ Title %02d  %s\n", r.Title.ID, r.Output)
+			if r.Transcoded != "" && r.Transcoded != r.Output {
+				fmt.Printf("      ↳ %s\n", r.Transcoded)
+			}
+		case "skipped":
+			fmt.Printf("  ✓ Title %02d  %s (resumed)\n", r.Title.ID, r.Output)
+		case "mismatch":
+			fmt.Printf("  ✗ Title %02d  %s does not match the disc:\n", r.Title.ID, r.Output)
+			for _, issue := range r.Issues {
+				fmt.Printf("      - %s\n", issue)
+			}
+		case "failed":
+			fmt.Printf("  ✗ Title %02d  failed: %v\n", r.Title.ID, r.Err)
+		case "cancelled":
+			fmt.Printf("  - Title %02d  cancelled\n", r.Title.ID)
+		}
+		for _, warning := range r.Warnings {
+			fmt.Printf("      ⚠ %s\n", warning)
+		}
+	}
+	for _, failure := range hookFailures {
+		fmt.Printf("  ⚠ %s\n", failure)
+	}
+	if len(done) == len(results) {
+		fmt.Printf("✓ Done. Wrote %d file(s) to: %s\n", len(done), outDir)
+	} else {
+		fmt.Printf("Wrote %d of %d file(s) to: %s\n", len(done), len(results), outDir)
+	}
 }
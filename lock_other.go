@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// lockFile only opens the file where flock is not available, so nothing is actually locked.
+func lockFile(path string, wait bool) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+}
+
+func unlockFile(f *os.File) {
+	f.Close()
+}
@@ -1,44 +1,137 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
+	"syscall"
 )
 
 const VERSION = "0.0.0"
 
 func printUsage() {
 	println("Usage: ripmkv [options]")
+	println("       ripmkv backup -d <drive> -o <dir>")
+	println("       ripmkv batch <dir>... -o <dir>")
+	println("       ripmkv eject -d <drive>")
+	println("       ripmkv serve")
+	println("       ripmkv watch")
+	println("       ripmkv submit -d <drive> [options]")
+	println("       ripmkv jobs")
+	println("       ripmkv cancel <id>...")
+	println("       ripmkv verify <dir>...")
 	println("Version:", VERSION)
 	println("Example: ripmkv -d /dev/sr0 -n Title -o /path/to/output -t 0 1 2 -a eng jpn -s eng")
+	println("Commands:")
+	println("  backup                       Decrypt the disc into <dir>/<name> with makemkvcon backup, to rip later with -d file:<dir>/<name>")
+	println("  batch <dir>...               Rip every ISO and BDMV/VIDEO_TS folder below each dir, named from the volume label or --names")
+	println("  eject                        Eject the disc of -d, unless another ripmkv process is using the drive")
+	println("  serve                        Run the job queue: one job per drive at a time, shared io/transcode slots from the config")
+	println("  watch                        Rip each disc inserted into the drives with the watch options from the config, then eject it")
+	println("  submit [options]             Queue a rip of -d with the given options for serve")
+	println("  jobs                         List queued, running and finished jobs")
+	println("  cancel <id>...               Cancel queued jobs, or stop running ones")
+	println("  verify <dir>...              Recheck ripped files against the SHA256SUMS/XXH64SUMS manifests under each dir")
 	println("Options:")
 	println("  -l, --list                   List available tracks")
+	println("  --preview                    Mark the streams the rip will keep, used with -l")
 	println("  --minsize <size>             Filter tracks of at least this size, used with -l, e.g. 100M, 1.5G")
 	println("  --minlength <seconds>        Filter tracks of at least this length, used whenever -t is omitted, e.g. 3600")
-	println("  -d, --drive <path>           Specify the drive path, e.g. /dev/sr0")
+	println("  -d, --drive <path>           Specify the drive path, e.g. /dev/sr0, or a source: file:<backup dir>, iso:<image>")
 	println("  -t, --track <track>          Specify the tracks to rip, e.g. 0 1 2 ..., or all if none specified")
+	println("  --main                       Rip only the longest of the selected tracks, the main feature")
 	println("  -a, --audio <lang>           Specify the audio languages to keep, e.g. eng jpn")
 	println("  -s, --subtitle <lang>        Specify the subtitle languages to keep, e.g. eng jpn")
+	println("                               Without -a, -s or -p every stream is kept, makemkv's default selection is not used")
+	println("  --audio-class <class>        Keep only audio of these classes: main commentary descriptive music")
+	println("  --exclude-audio <class>      Drop audio of these classes, e.g. commentary descriptive")
 	println("  -n, --name <name>            Specify the output title name prefix, also used as segment title")
+	println("  --template <template>        Output path below the output directory, a Go template over .Disc, .Title, .Name, .Year, .ID")
+	println("                               e.g. \"{{.Disc.Name}}/{{.Name}} ({{.Year}}) - {{.Title.Playlist}}.mkv\", default \"{{.Name}}_{{.ID}}.mkv\"")
+	println("  --year <year>                Release year, available to --template as .Year")
+	println("  --library movies             Lay out the rip as a Plex/Jellyfin movie library below --root")
+	println("  --root <dir>                 Library root, e.g. /media/Movies")
+	println("  --edition <name>             Edition of the main feature, e.g. \"Director's Cut\"")
+	println("  --assign <track>=<kind>      Assign tracks explicitly: main, featurette, trailer, deleted, behindthescenes,")
+	println("                               interview, scene, short, other. Defaults go by duration")
+	println("  --series <name>              Rip TV episodes named \"Show - S02E05.mkv\", numbered on from the previous disc")
+	println("  --season <n>                 Season number, used with --series")
+	println("  --episode-order <track>      Tracks in episode order when the disc has them out of order, e.g. 4 2 3 1")
+	println("  --first-episode <n>          Restart episode numbering of this disc at n")
+	println("  --chapter-names <file>       Rename chapters from a file with one name per line")
+	println("  --chapter-template <tmpl>    Rename chapters from a Go template over .Number, .Start, .Name, .Title")
+	println("                               e.g. \"Chapter {{printf \\\"%02d\\\" .Number}}\"")
+	println("  --export-chapters            Write <output>.chapters.xml and <output>.chapters.txt next to each output")
+	println("  --export-subs                Write each kept subtitle track next to the output as <output>.<lang>[.forced][.sdh].sup/.idx")
+	println("  --ocr                        Also OCR image subtitles to .srt with a local engine, used with --export-subs")
 	println("  -o, --outdir <output dir>    Specify the output directory, default is current directory")
+	println("  -p, --profile <name>         Use a named selection profile from the config instead of -a/-s")
+	println("  --explain-selection          Show which streams of each track the selection keeps")
+	println("  -c, --config <path>          Specify the config file, default is ~/.config/ripmkv/config.json")
+	println("  --hash <algo>                Checksums to write next to the outputs: sha256 (default), xxh64, none")
+	println("  --transcode <preset>         Transcode each output after ripping: auto picks by resolution and HDR, or a preset,")
+	println("                               e.g. h265-1080p, h264-compat, h265-2160p-hdr, or one defined in the config")
+	println("  --transcode-jobs <n>         Number of concurrent transcodes, default 1")
+	println("  --transcode-policy <policy>  keep (default) writes <output>.<preset>.mkv next to the original, replace overwrites it")
+	println("  --names <file>               JSON map of volume label or source file name to output name, used with batch")
+	println("  --dry-run                    Print the titles, streams, commands, output paths and hooks of the rip without running it")
+	println("  --info <file>                Read a saved \"makemkvcon -r info\" output instead of scanning the drive")
+	println("  --eject [when]               Eject the disc after the rip or backup: success (default), always, or never")
+	println("  --resume                     Skip tracks the output directory's manifest records as already ripped")
+	println("  -y, --yes                    Rip without asking when preflight finds problems")
 	println("  -v, --version                Show version information")
 	println("  -h, --help                   Show this help message")
 }
 
 type Arguments struct {
-	List      bool
-	MinSize   string
-	MinLength string
-	Drive     string
-	Tracks    []int64
-	Audio     []string
-	Subtitle  []string
-	Name      string
-	OutDir    string
-	Version   bool
-	Help      bool
+	Command         string
+	Paths           []string
+	List            bool
+	Preview         bool
+	MinSize         string
+	MinLength       string
+	Drive           string
+	Tracks          []int64
+	Main            bool
+	Audio           []string
+	Subtitle        []string
+	AudioClasses    []string
+	ExcludeAudio    []string
+	Name            string
+	OutDir          string
+	Template        string
+	Year            string
+	Library         string
+	Root            string
+	Edition         string
+	Assign          []string
+	Series          string
+	Season          int
+	EpisodeOrder    []string
+	FirstEpisode    int
+	ChapterNames    string
+	ChapterTemplate string
+	ExportChapters  bool
+	ExportSubs      bool
+	OCR             bool
+	Profile         string
+	Explain         bool
+	Config          string
+	Yes             bool
+	Resume          bool
+	Eject           string
+	Hash            []string
+	NamesFile       string
+	DryRun          bool
+	InfoFile        string
+	Transcode       string
+	TranscodeJobs   int
+	TranscodePolicy string
+	Version         bool
+	Help            bool
 }
 
 func parseArgs() Arguments {
@@ -47,6 +140,8 @@ func parseArgs() Arguments {
 		switch os.Args[idx] {
 		case "-l", "--list":
 			arguments.List = true
+		case "--preview":
+			arguments.Preview = true
 		case "--minsize":
 			arguments.MinSize = os.Args[idx+1]
 			idx++
@@ -76,6 +171,7 @@ func parseArgs() Arguments {
 					break
 				}
 				arguments.Audio = append(arguments.Audio, os.Args[subIdx])
+				idx++
 			}
 		case "-s", "--subtitle":
 			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
@@ -83,17 +179,143 @@ func parseArgs() Arguments {
 					break
 				}
 				arguments.Subtitle = append(arguments.Subtitle, os.Args[subIdx])
+				idx++
+			}
+		case "--audio-class":
+			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
+				if matched, _ := regexp.MatchString(`^-`, os.Args[subIdx]); matched {
+					break
+				}
+				arguments.AudioClasses = append(arguments.AudioClasses, os.Args[subIdx])
+				idx++
+			}
+		case "--exclude-audio":
+			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
+				if matched, _ := regexp.MatchString(`^-`, os.Args[subIdx]); matched {
+					break
+				}
+				arguments.ExcludeAudio = append(arguments.ExcludeAudio, os.Args[subIdx])
+				idx++
 			}
 		case "-n", "--name":
 			arguments.Name = os.Args[idx+1]
 			idx++
+		case "--template":
+			arguments.Template = os.Args[idx+1]
+			idx++
+		case "--year":
+			arguments.Year = os.Args[idx+1]
+			idx++
+		case "--library":
+			arguments.Library = os.Args[idx+1]
+			idx++
+		case "--root":
+			arguments.Root = os.Args[idx+1]
+			idx++
+		case "--edition":
+			arguments.Edition = os.Args[idx+1]
+			idx++
+		case "--assign":
+			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
+				if matched, _ := regexp.MatchString(`^-`, os.Args[subIdx]); matched {
+					break
+				}
+				arguments.Assign = append(arguments.Assign, os.Args[subIdx])
+				idx++
+			}
+		case "--series":
+			arguments.Series = os.Args[idx+1]
+			idx++
+		case "--season":
+			arguments.Season = atoi(os.Args[idx+1])
+			idx++
+		case "--episode-order":
+			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
+				if matched, _ := regexp.MatchString(`^-`, os.Args[subIdx]); matched {
+					break
+				}
+				arguments.EpisodeOrder = append(arguments.EpisodeOrder, os.Args[subIdx])
+				idx++
+			}
+		case "--first-episode":
+			arguments.FirstEpisode = atoi(os.Args[idx+1])
+			idx++
+		case "--chapter-names":
+			arguments.ChapterNames = os.Args[idx+1]
+			idx++
+		case "--chapter-template":
+			arguments.ChapterTemplate = os.Args[idx+1]
+			idx++
+		case "--export-chapters":
+			arguments.ExportChapters = true
+		case "--export-subs":
+			arguments.ExportSubs = true
+		case "--ocr":
+			arguments.OCR = true
 		case "-o", "--outdir":
 			arguments.OutDir = os.Args[idx+1]
 			idx++
+		case "-p", "--profile":
+			arguments.Profile = os.Args[idx+1]
+			idx++
+		case "--explain-selection":
+			arguments.Explain = true
+		case "-c", "--config":
+			arguments.Config = os.Args[idx+1]
+			idx++
+		case "--hash":
+			for subIdx := idx + 1; subIdx < len(os.Args); subIdx++ {
+				if matched, _ := regexp.MatchString(`^-`, os.Args[subIdx]); matched {
+					break
+				}
+				arguments.Hash = append(arguments.Hash, os.Args[subIdx])
+				idx++
+			}
+		case "--transcode":
+			arguments.Transcode = os.Args[idx+1]
+			idx++
+		case "--transcode-jobs":
+			arguments.TranscodeJobs = atoi(os.Args[idx+1])
+			idx++
+		case "--transcode-policy":
+			arguments.TranscodePolicy = os.Args[idx+1]
+			idx++
+		case "--main":
+			arguments.Main = true
+		case "--names":
+			arguments.NamesFile = os.Args[idx+1]
+			idx++
+		case "--dry-run":
+			arguments.DryRun = true
+		case "--info":
+			arguments.InfoFile = os.Args[idx+1]
+			idx++
+		case "--resume":
+			arguments.Resume = true
+		case "--eject":
+			arguments.Eject = EjectSuccess
+			if idx+1 < len(os.Args) {
+				switch os.Args[idx+1] {
+				case EjectSuccess, EjectAlways, EjectNever:
+					arguments.Eject = os.Args[idx+1]
+					idx++
+				}
+			}
+		case "-y", "--yes":
+			arguments.Yes = true
 		case "-v", "--version":
 			arguments.Version = true
 		case "-h", "--help":
 			arguments.Help = true
+		default:
+			if matched, _ := regexp.MatchString(`^-`, os.Args[idx]); matched {
+				break
+			}
+			if idx == 1 {
+				arguments.Command = os.Args[idx]
+			} else {
+				arguments.Paths = append(arguments.Paths, os.Args[idx])
+			}
 		}
 	}
 	return arguments
@@ -112,11 +334,75 @@ func main() {
 		os.Exit(0)
 	}
 
+	switch args.Command {
+	case "":
+	case "backup":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		BackupTracks(ctx, args)
+		stop()
+		os.Exit(0)
+	case "eject":
+		EjectDrive(args)
+		os.Exit(0)
+	case "batch", "serve", "watch", "submit", "jobs", "cancel":
+	case "verify":
+		VerifyLibraries(args)
+		os.Exit(0)
+	default:
+		fmt.Println("Unknown command:", args.Command)
+		printUsage()
+		os.Exit(1)
+	}
+
+	config := LoadConfig(args)
+	validateAudioClasses(args.AudioClasses)
+	validateAudioClasses(args.ExcludeAudio)
+
+	switch args.Command {
+	case "batch":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		BatchRip(ctx, args, config)
+		stop()
+		os.Exit(0)
+	case "serve":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		ServeQueue(ctx, config)
+		stop()
+		os.Exit(0)
+	case "watch":
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		WatchDrives(ctx, args, config)
+		stop()
+		os.Exit(0)
+	case "submit":
+		SubmitJob(args, config)
+		os.Exit(0)
+	case "jobs":
+		ListJobs(config)
+		os.Exit(0)
+	case "cancel":
+		CancelJobs(args, config)
+		os.Exit(0)
+	}
+
+	if args.Explain {
+		ExplainSelection(args, config)
+		os.Exit(0)
+	}
+
 	if args.List {
-		ListTracks(args)
+		ListTracks(args, config)
 		os.Exit(0)
 	}
 
-	RipTracks(args)
+	if args.DryRun {
+		PlanDisc(args, config)
+		os.Exit(0)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	RipTracks(ctx, args, config)
 	os.Exit(0)
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type ManifestTitle struct {
+	ID          int       `json:"id"`
+	Playlist    string    `json:"playlist"`
+	Duration    string    `json:"duration"`
+	Bytes       int64     `json:"bytes"`
+	Status      string    `json:"status"` // ripping | done | mismatch | failed | cancelled
+	Output      string    `json:"output,omitempty"`
+	OutputBytes int64     `json:"output_bytes,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Updated     time.Time `json:"updated"`
+}
+
+type Manifest struct {
+	path   string
+	Disc   string          `json:"disc"`
+	Type   string          `json:"type"`
+	Volume string          `json:"volume"`
+	Titles []ManifestTitle `json:"titles"`
+}
+
+func manifestPath(outDir string, disc Disc) string {
+	return filepath.Join(outDir, "."+sanitizeFilename(firstNonEmpty(disc.Volume, disc.Name))+".ripmkv.json")
+}
+
+// LoadManifest reads the disc's manifest from the output directory, or starts an empty one.
+func LoadManifest(outDir string, disc Disc) (*Manifest, error) {
+	manifest := &Manifest{path: manifestPath(outDir, disc)}
+	data, err := os.ReadFile(manifest.path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, err
+		}
+	}
+	manifest.Disc = disc.Name
+	manifest.Type = disc.Type
+	manifest.Volume = disc.Volume
+	return manifest, nil
+}
+
+// sameTitle matches titles by content rather than ID, which can shift between scans.
+func sameTitle(m ManifestTitle, t Title) bool {
+	return m.Playlist == t.Playlist && m.Duration == t.Duration && m.Bytes == t.Bytes
+}
+
+func (m *Manifest) Find(t Title) (ManifestTitle, bool) {
+	for _, entry := range m.Titles {
+		if sameTitle(entry, t) {
+			return entry, true
+		}
+	}
+	return ManifestTitle{}, false
+}
+
+// Completed reports whether the title was ripped before and its output is still intact.
+func (m *Manifest) Completed(t Title) (ManifestTitle, bool) {
+	entry, ok := m.Find(t)
+	if !ok || entry.Status != "done" || entry.Output == "" {
+		return entry, false
+	}
+	info, err := os.Stat(entry.Output)
+	if err != nil || info.Size() != entry.OutputBytes {
+		return entry, false
+	}
+	return entry, true
+}
+
+// Update records a title's status and output, then saves the manifest. An update without an output keeps
+// the earlier one, whose file stays in place until a rip replaces it.
+func (m *Manifest) Update(t Title, status string, output string, ripErr error) error {
+	if output != "" {
+		if abs, err := filepath.Abs(output); err == nil {
+			output = abs
+		}
+	}
+	entry := ManifestTitle{
+		ID:       t.ID,
+		Playlist: t.Playlist,
+		Duration: t.Duration,
+		Bytes:    t.Bytes,
+		Status:   status,
+		Output:   output,
+		Updated:  time.Now(),
+	}
+	if output != "" {
+		if info, err := os.Stat(output); err == nil {
+			entry.OutputBytes = info.Size()
+		}
+	}
+	if ripErr != nil {
+		entry.Error = ripErr.Error()
+	}
+
+	replaced := false
+	for i := range m.Titles {
+		if sameTitle(m.Titles[i], t) {
+			if entry.Output == "" {
+				entry.Output, entry.OutputBytes = m.Titles[i].Output, m.Titles[i].OutputBytes
+			}
+			m.Titles[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		m.Titles = append(m.Titles, entry)
+	}
+	return m.Save()
+}
+
+func (m *Manifest) Save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
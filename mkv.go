@@ -1,10 +1,69 @@
 package main
 
-func ListTracks(args Arguments) {
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+func ListTracks(args Arguments, config Config) {
+	disc := LoadDisc(args)
+	PrintDiscTree(disc, args, config)
+}
+
+func ExplainSelection(args Arguments, config Config) {
 	disc := LoadDisc(args)
-	PrintDiscTree(disc, args)
+	PrintSelection(disc, args, config)
+}
+
+func VerifyLibraries(args Arguments) {
+	if len(args.Paths) == 0 {
+		fmt.Println("No directory specified. Usage: ripmkv verify <dir>...")
+		os.Exit(1)
+	}
+	failed := false
+	for _, path := range args.Paths {
+		if err := VerifyLibrary(path); err != nil {
+			fmt.Println(err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func BackupTracks(ctx context.Context, args Arguments) {
+	if err := BackupDisc(ctx, args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func EjectDrive(args Arguments) {
+	if err := Eject(args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func ServeQueue(ctx context.Context, config Config) {
+	if err := Serve(ctx, config); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func WatchDrives(ctx context.Context, args Arguments, config Config) {
+	if err := Watch(ctx, args, config); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
 
-func RipTracks(args Arguments) {
-	RipDisc(args)
+func RipTracks(ctx context.Context, args Arguments, config Config) {
+	if _, err := RipDisc(ctx, args, config); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const defaultTemplate = "{{.Name}}_{{.ID}}.mkv"
+
+// nameData is what output naming templates are executed against.
+type nameData struct {
+	Disc  Disc
+	Title Title
+	Name  string // -n, or the disc name when -n is missing
+	Year  string // --year
+	ID    string // zero-padded title ID, e.g. "03"
+
+	Series  string // --series
+	Season  string // zero-padded --season, e.g. "02"
+	Episode string // zero-padded episode number, e.g. "05"
+}
+
+func newNameData(args Arguments, disc Disc, t Title) nameData {
+	name := args.Name
+	if name == "" {
+		name = firstNonEmpty(disc.Name, disc.Volume)
+	}
+	return nameData{
+		Disc:  disc,
+		Title: t,
+		Name:  name,
+		Year:  args.Year,
+		ID:    fmt.Sprintf("%02d", t.ID),
+
+		Series: args.Series,
+		Season: fmt.Sprintf("%02d", args.Season),
+	}
+}
+
+func outputTemplate(args Arguments, config Config) *template.Template {
+	text := firstNonEmpty(args.Template, config.Template, defaultTemplate)
+	if args.Series != "" {
+		text = firstNonEmpty(args.Template, seriesTemplate)
+	}
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		fmt.Println("Invalid output template:", err)
+		os.Exit(1)
+	}
+	return tmpl
+}
+
+// namer returns the final output path of a title.
+type namer func(t Title) (string, error)
+
+// outputNamer picks the naming scheme: a library layout when --library is set, the naming template otherwise.
+// In series mode the template also gets episode numbers carried over from the previous disc.
+func outputNamer(args Arguments, config Config, disc Disc, titles []Title) (namer, error) {
+	if args.Library == "movies" {
+		kinds := classifyMovieTitles(titles, parseAssignments(args.Assign))
+		return func(t Title) (string, error) {
+			return filepath.Join(args.OutDir, movieLibraryPath(newNameData(args, disc, t), kinds[t.ID], args.Edition)), nil
+		}, nil
+	}
+
+	tmpl := outputTemplate(args, config)
+
+	if args.Series != "" {
+		// A dry run only reads the state, and its output directory may not exist yet.
+		if !args.DryRun {
+			unlock, err := lockSeriesState(args.OutDir)
+			if err != nil {
+				return nil, fmt.Errorf("error locking series state: %w", err)
+			}
+			defer unlock()
+		}
+		state, err := LoadSeriesState(args.OutDir)
+		if err != nil {
+			return nil, fmt.Errorf("error reading series state: %w", err)
+		}
+		episodes := state.AssignEpisodes(args.Series, args.Season, disc, titles, args, config)
+		// A dry run shows the episode numbers without claiming them.
+		if !args.DryRun {
+			if err := state.Save(); err != nil {
+				return nil, fmt.Errorf("error writing series state: %w", err)
+			}
+		}
+		return func(t Title) (string, error) {
+			data := newNameData(args, disc, t)
+			data.Episode = fmt.Sprintf("%02d", episodes[t.ID])
+			return outputPath(tmpl, args.OutDir, data)
+		}, nil
+	}
+
+	return func(t Title) (string, error) {
+		return outputPath(tmpl, args.OutDir, newNameData(args, disc, t))
+	}, nil
+}
+
+// checkOutputPaths fails when two titles would be written to the same path, or when a title would replace
+// a file that the disc's manifest does not record as an earlier rip of that title.
+func checkOutputPaths(titles []Title, name namer, manifest *Manifest) error {
+	seen := map[string]Title{}
+	for _, t := range titles {
+		dest, err := name(t)
+		if err != nil {
+			return fmt.Errorf("error naming output: %w", err)
+		}
+		if other, ok := seen[dest]; ok {
+			return fmt.Errorf("titles %02d and %02d would both be written to %s, use a template that tells them apart, e.g. with {{.ID}}", other.ID, t.ID, dest)
+		}
+		seen[dest] = t
+
+		if _, err := os.Stat(dest); err != nil || earlierRip(dest, t, manifest) {
+			continue
+		}
+		return fmt.Errorf("%s already exists and is not an earlier rip of title %02d of this disc, refusing to replace it", dest, t.ID)
+	}
+	return nil
+}
+
+// earlierRip reports whether dest is the output the manifest records for an earlier rip of the title, which
+// a re-rip may replace.
+func earlierRip(dest string, t Title, manifest *Manifest) bool {
+	if manifest == nil {
+		return false
+	}
+	abs, err := filepath.Abs(dest)
+	if err != nil {
+		return false
+	}
+	entry, ok := manifest.Find(t)
+	return ok && entry.Output == abs
+}
+
+// outputPath renders the naming template for a title into a sanitized path below outDir.
+// Every path component is sanitized on its own, so templates can create directories but never escape outDir.
+func outputPath(tmpl *template.Template, outDir string, data nameData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, part := range strings.Split(filepath.ToSlash(b.String()), "/") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		parts = append(parts, sanitizeFilename(part))
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("template produced an empty file name")
+	}
+
+	last := len(parts) - 1
+	if !strings.EqualFold(filepath.Ext(parts[last]), ".mkv") {
+		parts[last] += ".mkv"
+	}
+	return filepath.Join(append([]string{outDir}, parts...)...), nil
+}
@@ -20,8 +20,8 @@ type Track struct {
 	SizeHuman    string         // TiSizeHuman
 	SizeBytes    int64          // TiSizeBytes
 	Playlist     string         // TiPlaylist (e.g., "00038.mpls")
-	VideoTracks  int            // TiVideoTracks
-	AudioTracks  int            // TiAudioTracks
+	Segments     int            // TiSegmentsCount
+	SegmentsMap  string         // TiSegmentsMap
 	DefaultOut   string         // TiDefaultOutName
 	LangCode     string         // TiLangCode
 	LangName     string         // TiLangName
@@ -112,10 +112,10 @@ func ParseTInfo(tInfo []TInfo) map[int]Track {
 			track.SizeBytes = atoi64(info.Value)
 		case TiPlaylist:
 			track.Playlist = info.Value
-		case TiVideoTracks:
-			track.VideoTracks = atoi(info.Value)
-		case TiAudioTracks:
-			track.AudioTracks = atoi(info.Value)
+		case TiSegmentsCount:
+			track.Segments = atoi(info.Value)
+		case TiSegmentsMap:
+			track.SegmentsMap = info.Value
 		case TiDefaultOutName:
 			track.DefaultOut = info.Value
 		case TiLangCode:
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PlanDisc prints what a rip would do: the selected titles and streams, every command with its arguments,
+// the output paths and the hooks. Nothing is executed and nothing is written.
+func PlanDisc(args Arguments, config Config) {
+	args = validateRipArgs(args)
+	disc := LoadDisc(args)
+	if args.Drive == "" {
+		args.Drive = "<drive>"
+	}
+
+	profileName, profile := ResolveProfile(args, config)
+	validateTranscode(args, config)
+	chapterTemplate(args.ChapterTemplate)
+	if args.ChapterNames != "" {
+		readChapterNames(args.ChapterNames)
+	}
+
+	fmt.Println("Dry run: nothing will be executed or written.")
+	fmt.Println()
+	fmt.Printf("Disc:      %s (%s, %s)\n", disc.Name, disc.Type, disc.Volume)
+	fmt.Printf("Profile:   %s\n", firstNonEmpty(profileName, "(from -a/-s)"))
+	fmt.Printf("Selection: %s\n", CompileSelection(profile))
+
+	if problems := Preflight(disc, args, config); len(problems) > 0 {
+		fmt.Println("Preflight:")
+		for _, problem := range problems {
+			fmt.Println("  ⚠", problem)
+		}
+		if !args.Yes {
+			fmt.Println("  The rip will ask for confirmation, or stop when not interactive. Use -y to rip anyway.")
+		}
+	}
+
+	titles := selectedTitles(disc, args)
+	if len(titles) == 0 {
+		fmt.Println("No titles selected. Nothing to do.")
+		return
+	}
+
+	tmpDir := filepath.Join(args.OutDir, ".ripmkv-XXXXXX")
+	options := makemkvOptions(filepath.Join(tmpDir, "ripmkv.mmcp.xml"))
+
+	manifest, err := LoadManifest(args.OutDir, disc)
+	if err != nil {
+		fmt.Println("Error reading manifest:", err)
+	}
+	name, err := outputNamer(args, config, disc, titles)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := checkOutputPaths(titles, name, manifest); err != nil {
+		fmt.Println("The rip would stop:", err)
+	}
+
+	var results []ripResult
+	for _, t := range titles {
+		fmt.Println()
+		fmt.Printf("Title %02d  %s  %s  %s\n", t.ID, t.Name, t.Duration, t.Size)
+
+		kept := SelectStreams(profile, t, config.PreferredLanguages)
+		for _, s := range titleStreams(t) {
+			mark := "-"
+			if kept[s.StreamID] {
+				mark = "+"
+			}
+			fmt.Printf("  %s %02d  %-8s  %-3s  %s\n", mark, s.StreamID, s.Kind, streamLang(s), streamSummary(t, s))
+		}
+
+		if args.Resume && manifest != nil {
+			if entry, ok := manifest.Completed(t); ok {
+				fmt.Printf("  Already ripped to %s, would be skipped.\n", entry.Output)
+				results = append(results, ripResult{Title: t, Status: "skipped", Output: entry.Output})
+				continue
+			}
+		}
+
+		dest, err := name(t)
+		if err != nil {
+			fmt.Println("  Error naming output:", err)
+			continue
+		}
+		planTitle(t, disc, args, config, profile, options, tmpDir, dest, kept)
+		results = append(results, ripResult{Title: t, Status: "done", Output: dest})
+	}
+
+	if len(config.Hooks.OnDiscDone) > 0 {
+		event := newHookEvent(HookDiscDone, disc, args.OutDir)
+		for _, r := range results {
+			event.Titles = append(event.Titles, newHookTitle(r))
+		}
+		fmt.Println()
+		planHooks(config.Hooks.OnDiscDone, event, "")
+	}
+
+	if source := discSource(args); strings.HasPrefix(source, "dev:") && (args.Eject == EjectSuccess || args.Eject == EjectAlways) {
+		when := "after a successful rip"
+		if args.Eject == EjectAlways {
+			when = "after the rip, also when it fails"
+		}
+		fmt.Println()
+		fmt.Printf("Eject (%s):\n", when)
+		fmt.Println("    $", shellJoin([]string{"eject", strings.TrimPrefix(source, "dev:")}))
+	}
+}
+
+func planTitle(t Title, disc Disc, args Arguments, config Config, profile Profile, options []string, tmpDir string, dest string, kept map[int]bool) {
+	titleDir := filepath.Join(tmpDir, fmt.Sprintf("t%02d", t.ID))
+	file := filepath.Join(titleDir, firstNonEmpty(t.OutName, fmt.Sprintf("title_t%02d.mkv", t.ID)))
+	run := func(name string, argv ...string) {
+		fmt.Println("    $", shellJoin(append([]string{name}, argv...)))
+	}
+
+	fmt.Println("  Commands:")
+	argv := append([]string(nil), options...)
+	run("makemkvcon", append(argv, discSource(args), fmt.Sprint(t.ID), titleDir)...)
+	if argv := dropAudioArgs(file, file+".remux.mkv", t, profile, config); argv != nil {
+		run("mkvmerge", argv...)
+	}
+	if argv := trackPropeditArgs(file, t, profile, config); argv != nil {
+		run("mkvpropedit", argv...)
+	}
+	if args.Name != "" {
+		run("mkvpropedit", file, "--edit", "info", "--set", "title="+args.Name)
+	}
+	run("mkvpropedit", file, "--tags", "global:"+filepath.Join(titleDir, filepath.Base(file)+".tags.xml"))
+	if args.ChapterNames != "" || args.ChapterTemplate != "" || args.ExportChapters {
+		run("mkvextract", file, "chapters", "--simple", filepath.Join(titleDir, filepath.Base(file)+".chapters.txt"))
+	}
+	if args.ChapterNames != "" || args.ChapterTemplate != "" {
+		run("mkvpropedit", file, "--chapters", filepath.Join(titleDir, filepath.Base(file)+".chapters.xml"))
+	}
+
+	fmt.Println("  Output:")
+	fmt.Println("    " + dest)
+	if args.ExportChapters {
+		base := dest[:len(dest)-len(filepath.Ext(dest))]
+		fmt.Println("    " + base + ".chapters.xml")
+		fmt.Println("    " + base + ".chapters.txt")
+	}
+
+	if args.ExportSubs {
+		planSubtitles(t, dest, args, config, profile, kept, run)
+	}
+
+	result := ripResult{Title: t, Status: "done", Output: dest}
+	if args.Transcode != "" {
+		if preset := transcodePreset(t, args, config); preset != "" {
+			output, tmp := transcodeOutput(dest, preset, transcodePresets(config)[preset], transcodePolicy(args, config))
+			fmt.Printf("  Transcode (%s, %s original):\n", preset, transcodePolicy(args, config))
+			cmd := transcodeCommand(context.Background(), transcodePresets(config)[preset], dest, tmp)
+			run(cmd.Args[0], cmd.Args[1:]...)
+			fmt.Println("    ==> " + output)
+			result.Transcoded = output
+			if transcodePolicy(args, config) == "replace" {
+				result.Output = output
+			}
+		}
+	}
+
+	if len(config.Hooks.OnTitleDone) > 0 {
+		event := newHookEvent(HookTitleDone, disc, args.OutDir)
+		title := newHookTitle(result)
+		event.Title = &title
+		planHooks(config.Hooks.OnTitleDone, event, "  ")
+	}
+	if len(config.Hooks.OnFailure) > 0 {
+		fmt.Printf("  Hooks (%s, if the title fails):\n", HookFailure)
+		for _, command := range config.Hooks.OnFailure {
+			fmt.Printf("      $ sh -c %s\n", shellJoin([]string{command}))
+		}
+	}
+}
+
+// planSubtitles prints the sidecar extraction of --export-subs. Track IDs are predicted from the kept
+// streams, the rip reads them from the output.
+func planSubtitles(t Title, dest string, args Arguments, config Config, profile Profile, kept map[int]bool, run func(string, ...string)) {
+	subs := keptSubtitles(t, profile, config)
+	if len(subs) == 0 {
+		return
+	}
+	streams := titleStreams(t)
+	sort.Slice(streams, func(i, j int) bool { return streams[i].StreamID < streams[j].StreamID })
+	trackID := map[int]int{}
+	n := 0
+	for _, s := range streams {
+		if kept[s.StreamID] {
+			trackID[s.StreamID] = n
+			n++
+		}
+	}
+	ids := make([]int, len(subs))
+	for i, s := range subs {
+		ids[i] = trackID[s.StreamID]
+	}
+
+	argv, sidecars, _ := subtitleExtractArgs(dest, subs, ids)
+	if argv == nil {
+		return
+	}
+	fmt.Println("  Subtitles:")
+	run("mkvextract", argv...)
+	if !args.OCR {
+		return
+	}
+	for i, s := range subs {
+		sidecar, ok := sidecars[i]
+		if !ok || !isImageSubtitle(s.CodecID) {
+			continue
+		}
+		ocr, err := ocrArgs(sidecar, ocrOutput(sidecar), s, config)
+		if err != nil {
+			fmt.Println("    ", err)
+			return
+		}
+		run(ocr[0], ocr[1:]...)
+	}
+}
+
+func planHooks(commands []string, event hookEvent, indent string) {
+	fmt.Printf("%sHooks (%s):\n", indent, event.Event)
+	for _, command := range commands {
+		fmt.Printf("%s    $ sh -c %s\n", indent, shellJoin([]string{command}))
+	}
+	for _, env := range hookEnv(event) {
+		key, value, _ := strings.Cut(env, "=")
+		fmt.Printf("%s      %s=%s\n", indent, key, shellJoin([]string{value}))
+	}
+}
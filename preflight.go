@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// selectedTitles returns the titles a rip will produce: the -t tracks, or every title of at least --minlength.
+// --main narrows them down to the longest.
+func selectedTitles(disc Disc, args Arguments) []Title {
+	titles := append([]Title(nil), disc.Titles...)
+	if len(args.Tracks) > 0 {
+		titles = filter(titles, func(t Title) bool { return slices.Contains(args.Tracks, int64(t.ID)) })
+	} else if (args.MinLength != "") && (args.MinLength != "0") {
+		minSeconds := atoi64(args.MinLength)
+		titles = filter(titles, func(t Title) bool { return durationSeconds(t.Duration) >= minSeconds })
+	}
+	if args.Main && len(titles) > 0 {
+		main := titles[0]
+		for _, t := range titles[1:] {
+			if durationSeconds(t.Duration) > durationSeconds(main.Duration) {
+				main = t
+			}
+		}
+		titles = []Title{main}
+	}
+	sort.Slice(titles, func(i, j int) bool { return titles[i].ID < titles[j].ID })
+	return titles
+}
+
+// Preflight checks the requested languages against the selected titles and returns a problem per line.
+func Preflight(disc Disc, args Arguments, config Config) []string {
+	var problems []string
+
+	titles := selectedTitles(disc, args)
+	if len(titles) == 0 {
+		return []string{"No titles match the requested tracks."}
+	}
+
+	_, profile := ResolveProfile(args, config)
+
+	audioLangs := map[string]bool{}
+	subLangs := map[string]bool{}
+	for _, t := range titles {
+		for _, a := range t.Audio {
+			audioLangs[normalizeLang(a.LanguageCode)] = true
+		}
+		for _, s := range t.Subtitles {
+			subLangs[normalizeLang(s.LanguageCode)] = true
+		}
+	}
+	for _, lang := range langList(profile.Audio) {
+		if !audioLangs[lang] {
+			problems = append(problems, fmt.Sprintf("Audio language %q is not on any selected title (available: %s)", lang, joinKeys(audioLangs)))
+		}
+	}
+	for _, lang := range langList(profile.Subtitle) {
+		if !subLangs[lang] {
+			problems = append(problems, fmt.Sprintf("Subtitle language %q is not on any selected title (available: %s)", lang, joinKeys(subLangs)))
+		}
+	}
+
+	for _, t := range titles {
+		kept := SelectStreams(profile, t, config.PreferredLanguages)
+		if len(t.Audio) > 0 && len(filter(t.Audio, func(a Audio) bool { return kept[a.StreamID] })) == 0 {
+			problems = append(problems, fmt.Sprintf("Title %02d (%s) would lose all audio", t.ID, t.Duration))
+		}
+		if len(t.Subtitles) > 0 && len(filter(t.Subtitles, func(s Subtitles) bool { return kept[s.StreamID] })) == 0 {
+			problems = append(problems, fmt.Sprintf("Title %02d (%s) would lose all subtitles", t.ID, t.Duration))
+		}
+	}
+
+	return problems
+}
+
+func joinKeys(m map[string]bool) string {
+	if len(m) == 0 {
+		return "none"
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// checkPreflight reports preflight problems and returns an error unless the user confirms or passed --yes.
+// Batches never ask, a source with problems fails unless --yes is given.
+func checkPreflight(disc Disc, args Arguments, config Config) error {
+	problems := Preflight(disc, args, config)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Println("Preflight found problems with the requested selection:")
+	for _, problem := range problems {
+		fmt.Println("  ⚠", problem)
+	}
+	if args.Yes {
+		return nil
+	}
+	if !isInteractive() || args.Command == "batch" {
+		return errors.New("refusing to rip in non-interactive mode, use -y or --yes to rip anyway")
+	}
+	if !confirm("Rip anyway?") {
+		return errors.New("rip aborted")
+	}
+	return nil
+}
@@ -7,7 +7,9 @@ import (
 	"strings"
 )
 
-func PrintDiscTree(disc Disc, args Arguments) {
+func PrintDiscTree(disc Disc, args Arguments, config Config) {
+	_, profile := ResolveProfile(args, config)
+
 	fmt.Printf("Name:   %s\n", disc.Name)
 	fmt.Printf("Type:   %s\n", disc.Type)
 	fmt.Printf("Volume: %s\n", disc.Volume)
@@ -45,9 +47,36 @@ func PrintDiscTree(disc Disc, args Arguments) {
 			audioStr,
 			subsStr,
 		)
+
+		if args.Preview {
+			printPreview(t, profile, config)
+		}
+	}
+}
+
+func printPreview(t Title, profile Profile, config Config) {
+	kept := SelectStreams(profile, t, config.PreferredLanguages)
+	for _, a := range t.Audio {
+		fmt.Printf("%9s %s audio     %-3s  %-11s  %s %s  %s\n", "", keptMark(kept[a.StreamID]), normalizeLang(a.LanguageCode),
+			a.Class, formatChannels(a.Channels), firstNonEmpty(a.CodecShort, a.CodecLong, a.CodecID), a.Description)
+	}
+	for _, s := range t.Subtitles {
+		fmt.Printf("%9s %s subtitle  %-3s  %-11s  %s  %s\n", "", keptMark(kept[s.StreamID]), normalizeLang(s.LanguageCode), subtitleKind(s),
+			firstNonEmpty(s.CodecShort, s.CodecLong, s.CodecID), s.Description)
+	}
+	fmt.Printf("%9s Estimated output: %s\n", "", bytesToSize(EstimateOutputBytes(t, kept)))
+	if missingAudio(t, kept, profile) {
+		fmt.Printf("%9s ⚠ No audio in requested languages: %s\n", "", strings.Join(langList(profile.Audio), ", "))
 	}
 }
 
+func keptMark(kept bool) string {
+	if kept {
+		return "✓"
+	}
+	return "✗"
+}
+
 func normalizeResolution(res string) string {
 	switch res {
 	case "1920x1080":
@@ -96,6 +125,7 @@ type audioKey struct {
 	Channels string
 	Codec    string
 	Layout   string
+	Class    string
 }
 
 func formatAudioGrouped(list []Audio) string {
@@ -112,6 +142,7 @@ func formatAudioGrouped(list []Audio) string {
 			Channels: formatChannels(a.Channels),
 			Codec:    firstNonEmpty(a.CodecShort, a.CodecLong, a.CodecID),
 			Layout:   strings.TrimSpace(a.Layout),
+			Class:    audioClassTag(a.Class),
 		}
 		if _, ok := perLang[lang]; !ok {
 			perLang[lang] = map[audioKey]bool{}
@@ -151,12 +182,15 @@ func formatAudioGrouped(list []Audio) string {
 			if items[i].Codec != items[j].Codec {
 				return items[i].Codec < items[j].Codec
 			}
+			if items[i].Class != items[j].Class {
+				return items[i].Class < items[j].Class
+			}
 			return items[i].Layout < items[j].Layout
 		})
 
 		var parts []string
 		for _, k := range items {
-			entry := fmt.Sprintf("%s %s", k.Channels, k.Codec)
+			entry := fmt.Sprintf("%s %s%s", k.Channels, k.Codec, k.Class)
 			if perLang[l][k] {
 				entry += "*"
 			}
@@ -183,7 +217,7 @@ func formatSubsDeduped(list []Subtitles) string {
 		if lang == "" || lang == "?" {
 			lang = "und"
 		}
-		flags := subFlags(s.Description)
+		flags := subFlags(s)
 		k := subKey{Lang: lang, Flags: flags}
 		m[k] = m[k] || s.Default
 	}
@@ -227,16 +261,70 @@ func formatSubsDeduped(list []Subtitles) string {
 	return strings.Join(out, ", ")
 }
 
-func subFlags(desc string) string {
-	d := strings.ToLower(desc)
-	hasForced := strings.Contains(d, "forced")
-	hasSDH := strings.Contains(d, "sdh") || strings.Contains(d, "hoh")
+func subFlags(s Subtitles) string {
 	var flags []string
-	if hasForced {
+	if s.Forced {
 		flags = append(flags, "⚑")
 	}
-	if hasSDH {
+	if s.SDH {
 		flags = append(flags, "Ⓢ")
 	}
 	return strings.Join(flags, "")
 }
+
+func PrintSelection(disc Disc, args Arguments, config Config) {
+	name, profile := ResolveProfile(args, config)
+	selection := CompileSelection(profile)
+	if name == "" {
+		name = "(from -a/-s)"
+	}
+
+	fmt.Printf("Name:      %s\n", disc.Name)
+	fmt.Printf("Profile:   %s\n", name)
+	fmt.Printf("Selection: %s\n", selection)
+
+	titles := append([]Title(nil), disc.Titles...)
+	if (args.MinSize != "") && (args.MinSize != "0") {
+		minBytes := sizeToBytes(args.MinSize)
+		titles = filter(titles, func(t Title) bool { return t.Bytes >= minBytes })
+	}
+	sort.Slice(titles, func(i, j int) bool { return titles[i].ID < titles[j].ID })
+	for _, t := range titles {
+		kept := SelectStreams(profile, t, config.PreferredLanguages)
+		fmt.Println()
+		fmt.Printf("Title %02d  %s  %s  %s\n", t.ID, t.Name, t.Duration, t.Size)
+		for _, s := range titleStreams(t) {
+			mark := "-"
+			if kept[s.StreamID] {
+				mark = "+"
+			}
+			fmt.Printf("  %s %02d  %-8s  %-3s  %s\n", mark, s.StreamID, s.Kind, streamLang(s), streamSummary(t, s))
+		}
+	}
+}
+
+func streamLang(s selStream) string {
+	if s.Kind == "video" {
+		return ""
+	}
+	return s.Lang
+}
+
+func streamSummary(t Title, s selStream) string {
+	for _, v := range t.Video {
+		if v.StreamID == s.StreamID {
+			return fmt.Sprintf("%s • %s • %s", firstNonEmpty(v.CodecShort, v.CodecLong, v.CodecID), normalizeResolution(v.Resolution), shortFrameRate(v.FrameRate))
+		}
+	}
+	for _, a := range t.Audio {
+		if a.StreamID == s.StreamID {
+			return fmt.Sprintf("%s %s  %s  [%s]", formatChannels(a.Channels), firstNonEmpty(a.CodecShort, a.CodecLong, a.CodecID), a.Description, a.Class)
+		}
+	}
+	for _, sub := range t.Subtitles {
+		if sub.StreamID == s.StreamID {
+			return fmt.Sprintf("%s  %s  [%s]", firstNonEmpty(sub.CodecShort, sub.CodecLong, sub.CodecID), sub.Description, subtitleKind(sub))
+		}
+	}
+	return ""
+}
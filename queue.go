@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Job struct {
+	ID        int        `json:"id"`
+	Source    string     `json:"source"`           // makemkvcon source, e.g. "dev:/dev/sr0" or "file:/backups/UP_USA"
+	Args      []string   `json:"args"`             // ripmkv arguments of the rip
+	Dir       string     `json:"dir"`              // working directory the job was submitted from
+	Status    string     `json:"status"`           // queued | running | done | failed | cancelled
+	Cancel    bool       `json:"cancel,omitempty"` // cancellation requested while running
+	PID       int        `json:"pid,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Attempts  int        `json:"attempts,omitempty"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+}
+
+// Queue is the serve job queue. It is shared by the daemon and the submit, jobs and cancel commands, which
+// only ever change it through withQueue.
+type Queue struct {
+	NextID int    `json:"next_id"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+func (q *Queue) Find(id int) *Job {
+	for _, job := range q.Jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// withQueue loads the queue in dir under its lock, runs fn, and saves the queue if fn succeeds.
+func withQueue(dir string, fn func(q *Queue) error) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	lock, err := lockFile(filepath.Join(dir, "queue.lock"), true)
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	path := filepath.Join(dir, "queue.json")
+	q := &Queue{NextID: 1}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, q); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(q); err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// selStream is the flattened view of a title stream that selection conditions are evaluated against.
+type selStream struct {
+	StreamID    int
+	Kind        string // "video" | "audio" | "subtitle"
+	Lang        string
+	Codec       string // all codec fields joined, for matching
+	Channels    int
+	Description string
+	Default     bool
+}
+
+func titleStreams(t Title) []selStream {
+	var list []selStream
+	for _, v := range t.Video {
+		list = append(list, selStream{
+			StreamID: v.StreamID,
+			Kind:     "video",
+			Codec:    strings.Join([]string{v.CodecID, v.CodecShort, v.CodecLong}, " "),
+		})
+	}
+	for _, a := range t.Audio {
+		list = append(list, selStream{
+			StreamID:    a.StreamID,
+			Kind:        "audio",
+			Lang:        normalizeLang(a.LanguageCode),
+			Codec:       strings.Join([]string{a.CodecID, a.CodecShort, a.CodecLong}, " "),
+			Channels:    a.Channels,
+			Description: a.Description,
+			Default:     a.Default,
+		})
+	}
+	for _, s := range t.Subtitles {
+		list = append(list, selStream{
+			StreamID:    s.StreamID,
+			Kind:        "subtitle",
+			Lang:        normalizeLang(s.LanguageCode),
+			Codec:       strings.Join([]string{s.CodecID, s.CodecShort, s.CodecLong}, " "),
+			Description: s.Description,
+			Default:     s.Default,
+		})
+	}
+	return list
+}
+
+func normalizeLang(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" {
+		return "und"
+	}
+	return code
+}
+
+func isLossless(codec string) bool {
+	c := strings.ToLower(codec)
+	for _, l := range []string{"truehd", "dts-hd ma", "master audio", "pcm", "flac", "mlp"} {
+		if strings.Contains(c, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// langList returns the languages of a profile list, or nil when the list keeps everything.
+func langList(langs []string) []string {
+	var out []string
+	for _, l := range langs {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "all" {
+			return nil
+		}
+		if l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// CompileSelection turns a profile into a makemkv app_DefaultSelectionString.
+func CompileSelection(profile Profile) string {
+	rules := []string{"-sel:all", "+sel:video"}
+
+	if langs := langList(profile.Audio); langs != nil {
+		rules = append(rules, fmt.Sprintf("+sel:(audio&(%s))", strings.Join(langs, "|")))
+	} else {
+		rules = append(rules, "+sel:audio")
+	}
+	if langs := langList(profile.Subtitle); langs != nil {
+		rules = append(rules, fmt.Sprintf("+sel:(subtitle&(%s))", strings.Join(langs, "|")))
+	} else {
+		rules = append(rules, "+sel:subtitle")
+	}
+	if profile.NoLang {
+		rules = append(rules, "+sel:((audio|subtitle)&nolang)")
+	}
+	if profile.DropCore {
+		rules = append(rules, "-sel:core")
+	}
+	if !profile.KeepMVC {
+		rules = append(rules, "-sel:mvcvideo")
+	}
+	for _, rule := range profile.Rules {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			rules = append(rules, rule)
+		}
+	}
+
+	return strings.Join(rules, ",")
+}
+
+// ResolveProfile returns the profile named by --profile, or one built from -a/-s.
+func ResolveProfile(args Arguments, config Config) (string, Profile) {
+	if args.Profile != "" {
+		profile, ok := config.Profiles[args.Profile]
+		if !ok {
+			fmt.Printf("Profile %q not found in config.\n", args.Profile)
+			os.Exit(1)
+		}
+		if len(args.AudioClasses) > 0 {
+			profile.AudioClasses = args.AudioClasses
+		}
+		profile.ExcludeAudio = append(profile.ExcludeAudio, args.ExcludeAudio...)
+		rules, err := expandFavlang(profile.Rules, config.PreferredLanguages)
+		if err != nil {
+			fmt.Printf("Profile %q: %v\n", args.Profile, err)
+			os.Exit(1)
+		}
+		profile.Rules = rules
+		return args.Profile, profile
+	}
+	return "", Profile{Audio: args.Audio, Subtitle: args.Subtitle, AudioClasses: args.AudioClasses, ExcludeAudio: args.ExcludeAudio}
+}
+
+// expandFavlang replaces favlang in profile rules with the preferred languages of the config. makemkvcon
+// would resolve it from its own preferred language setting, which the preview cannot see.
+func expandFavlang(rules []string, favlangs []string) ([]string, error) {
+	langs := langList(favlangs)
+	var out []string
+	for _, rule := range rules {
+		if favlangRegex.MatchString(rule) {
+			if len(langs) == 0 {
+				return nil, fmt.Errorf("rule %q uses favlang, set preferred_languages in the config", rule)
+			}
+			rule = favlangRegex.ReplaceAllLiteralString(rule, "("+strings.Join(langs, "|")+")")
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+// EstimateOutputBytes estimates the size of a ripped title by subtracting the dropped audio streams,
+// whose size is known from their bitrate. Subtitles are small enough to ignore.
+func EstimateOutputBytes(t Title, kept map[int]bool) int64 {
+	seconds := durationSeconds(t.Duration)
+	estimate := t.Bytes
+	for _, a := range t.Audio {
+		if !kept[a.StreamID] {
+			estimate -= bitrateToBps(a.Bitrate) / 8 * seconds
+		}
+	}
+	if estimate < 0 {
+		return 0
+	}
+	return estimate
+}
+
+// missingAudio reports whether a selection keeps no audio in any of the requested languages.
+func missingAudio(t Title, kept map[int]bool, profile Profile) bool {
+	langs := langList(profile.Audio)
+	if langs == nil {
+		return false
+	}
+	for _, a := range t.Audio {
+		if kept[a.StreamID] && containsFold(langs, normalizeLang(a.LanguageCode)) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	ruleRegex     = regexp.MustCompile(`^([+\-=])(sel|\d+):(.+)$`)
+	langCodeRegex = regexp.MustCompile(`^[a-z]{3}$`)
+	favlangRegex  = regexp.MustCompile(`\bfavlang\b`)
+)
+
+// EvaluateSelection applies a selection string to a title the way makemkv does,
+// returning the kept state of every stream keyed by stream ID.
+// Only "sel" rules affect selection; weight rules are ignored. Unknown condition tokens match nothing.
+func EvaluateSelection(selection string, t Title, favlangs []string) map[int]bool {
+	streams := titleStreams(t)
+	kept := make(map[int]bool, len(streams))
+	for _, s := range streams {
+		kept[s.StreamID] = true
+	}
+
+	for _, rule := range strings.Split(selection, ",") {
+		matches := ruleRegex.FindStringSubmatch(strings.TrimSpace(rule))
+		if matches == nil || matches[2] != "sel" || matches[1] == "=" {
+			continue
+		}
+		cond := parseCondition(matches[3])
+		for _, s := range streams {
+			if cond(s, streams, favlangs) {
+				kept[s.StreamID] = matches[1] == "+"
+			}
+		}
+	}
+
+	return kept
+}
+
+type condition func(s selStream, all []selStream, favlangs []string) bool
+
+func parseCondition(expr string) condition {
+	p := &condParser{input: strings.ReplaceAll(expr, " ", "")}
+	cond := p.parseOr()
+	if p.pos != len(p.input) {
+		return func(selStream, []selStream, []string) bool { return false }
+	}
+	return cond
+}
+
+type condParser struct {
+	input string
+	pos   int
+}
+
+func (p *condParser) peek() byte {
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *condParser) parseOr() condition {
+	left := p.parseAnd()
+	for p.peek() == '|' {
+		p.pos++
+		l, r := left, p.parseAnd()
+		left = func(s selStream, all []selStream, fav []string) bool { return l(s, all, fav) || r(s, all, fav) }
+	}
+	return left
+}
+
+func (p *condParser) parseAnd() condition {
+	left := p.parseNot()
+	for p.peek() == '&' {
+		p.pos++
+		l, r := left, p.parseNot()
+		left = func(s selStream, all []selStream, fav []string) bool { return l(s, all, fav) && r(s, all, fav) }
+	}
+	return left
+}
+
+func (p *condParser) parseNot() condition {
+	switch p.peek() {
+	case '!', '~':
+		p.pos++
+		inner := p.parseNot()
+		return func(s selStream, all []selStream, fav []string) bool { return !inner(s, all, fav) }
+	case '(':
+		p.pos++
+		inner := p.parseOr()
+		if p.peek() == ')' {
+			p.pos++
+		}
+		return inner
+	}
+	start := p.pos
+	for p.pos < len(p.input) && strings.IndexByte("|&!~()", p.input[p.pos]) < 0 {
+		p.pos++
+	}
+	return tokenCondition(p.input[start:p.pos])
+}
+
+func tokenCondition(token string) condition {
+	switch token {
+	case "all":
+		return func(selStream, []selStream, []string) bool { return true }
+	case "video", "audio", "subtitle":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == token }
+	case "favlang":
+		return func(s selStream, _ []selStream, fav []string) bool {
+			return s.Kind != "video" && containsFold(fav, s.Lang)
+		}
+	case "nolang":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind != "video" && s.Lang == "und" }
+	case "single":
+		return func(s selStream, all []selStream, _ []string) bool {
+			return len(filter(all, func(o selStream) bool { return o.Kind == s.Kind })) == 1
+		}
+	case "mvcvideo":
+		return func(s selStream, _ []selStream, _ []string) bool {
+			return s.Kind == "video" && strings.Contains(strings.ToUpper(s.Codec), "MVC")
+		}
+	case "lossless":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == "audio" && isLossless(s.Codec) }
+	case "lossy":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == "audio" && !isLossless(s.Codec) }
+	case "mono":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == "audio" && s.Channels == 1 }
+	case "stereo":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == "audio" && s.Channels == 2 }
+	case "multi":
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind == "audio" && s.Channels > 2 }
+	case "havemulti":
+		return func(s selStream, all []selStream, _ []string) bool {
+			if s.Kind != "audio" || s.Channels > 2 {
+				return false
+			}
+			return len(filter(all, func(o selStream) bool {
+				return o.Kind == "audio" && o.Lang == s.Lang && o.Channels > 2
+			})) > 0
+		}
+	case "core":
+		return func(s selStream, all []selStream, _ []string) bool {
+			if s.Kind != "audio" || isLossless(s.Codec) {
+				return false
+			}
+			return len(filter(all, func(o selStream) bool {
+				return o.Kind == "audio" && o.Lang == s.Lang && o.Channels == s.Channels && isLossless(o.Codec)
+			})) > 0
+		}
+	case "forced":
+		return func(s selStream, _ []selStream, _ []string) bool {
+			return s.Kind == "subtitle" && strings.Contains(strings.ToLower(s.Description), "forced")
+		}
+	}
+	if langCodeRegex.MatchString(token) {
+		return func(s selStream, _ []selStream, _ []string) bool { return s.Kind != "video" && s.Lang == token }
+	}
+	return func(selStream, []selStream, []string) bool { return false }
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeMakeMKVProfile writes a makemkv conversion profile carrying the selection string
+// and returns its path, for use with makemkvcon --profile.
+func writeMakeMKVProfile(dir string, selection string) (string, error) {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	b.WriteString("<profile>\n")
+	b.WriteString("    <name>ripmkv</name>\n")
+	b.WriteString("    <mkvSettings ignoreForcedSubtitlesFlag=\"true\" useISO639Type2T=\"false\" setFirstSubtitleTrackAsDefault=\"false\" setFirstForcedSubtitleTrackAsDefault=\"true\" setFirstAudioTrackAsDefault=\"true\" />\n")
+	fmt.Fprintf(&b, "    <profileSettings app_DefaultSelectionString=\"%s\" />\n", xmlEscape(selection))
+	b.WriteString("    <outputSettings name=\"copy\" outputFormat=\"directCopy\">\n")
+	b.WriteString("        <description>Copy track as is</description>\n")
+	b.WriteString("    </outputSettings>\n")
+	b.WriteString("    <trackSettings input=\"default\">\n")
+	b.WriteString("        <output_mkv outputSettingsName=\"copy\" defaultSelection=\"$app_DefaultSelectionString\" />\n")
+	b.WriteString("    </trackSettings>\n")
+	b.WriteString("</profile>\n")
+
+	path := filepath.Join(dir, "ripmkv.mmcp.xml")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;", "'", "&apos;").Replace(s)
+}
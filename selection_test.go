@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// selectionTitle has a 3D title's streams: main and MVC video, English TrueHD with its AC3 core, an English
+// stereo downmix, French and untagged audio, and English, Japanese and untagged subtitles.
+var selectionTitle = Title{
+	ID: 0,
+	Video: []Video{
+		{StreamID: 0, CodecID: "V_MPEG4/ISO/AVC", CodecShort: "Mpeg4", CodecLong: "Mpeg4 AVC High@L4.1"},
+		{StreamID: 1, CodecID: "V_MPEG4/ISO/MVC", CodecShort: "MVC", CodecLong: "Mpeg4 MVC High@L4.1"},
+	},
+	Audio: []Audio{
+		{StreamID: 2, CodecID: "A_TRUEHD", CodecShort: "TrueHD", CodecLong: "Dolby TrueHD", LanguageCode: "eng", Channels: 6},
+		{StreamID: 3, CodecID: "A_AC3", CodecShort: "DD", CodecLong: "Dolby Digital", LanguageCode: "eng", Channels: 6},
+		{StreamID: 4, CodecID: "A_AC3", CodecShort: "DD", CodecLong: "Dolby Digital", LanguageCode: "eng", Channels: 2},
+		{StreamID: 5, CodecID: "A_AC3", CodecShort: "DD", CodecLong: "Dolby Digital", LanguageCode: "fra", Channels: 2},
+		{StreamID: 6, CodecID: "A_AC3", CodecShort: "DD", CodecLong: "Dolby Digital", Channels: 2},
+	},
+	Subtitles: []Subtitles{
+		{StreamID: 7, CodecID: "S_HDMV/PGS", CodecShort: "PGS", LanguageCode: "eng"},
+		{StreamID: 8, CodecID: "S_HDMV/PGS", CodecShort: "PGS", LanguageCode: "jpn"},
+		{StreamID: 9, CodecID: "S_HDMV/PGS", CodecShort: "PGS"},
+	},
+}
+
+func TestEvaluateSelection(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection string
+		favlangs  []string
+		want      []int
+	}{
+		{"empty keeps all", "", nil, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"favlang or nolang without mvc", "-sel:all,+sel:(favlang|nolang),-sel:mvcvideo", []string{"eng"}, []int{2, 3, 4, 6, 7, 9}},
+		{"favlang without favlangs", "-sel:all,+sel:(favlang|nolang),-sel:mvcvideo", nil, []int{6, 9}},
+		{"havemulti drops the stereo downmix", "-sel:havemulti", nil, []int{0, 1, 2, 3, 5, 6, 7, 8, 9}},
+		{"core drops the lossy core", "-sel:core", nil, []int{0, 1, 2, 4, 5, 6, 7, 8, 9}},
+		{"language code", "-sel:all,+sel:video,+sel:(audio&fra)", nil, []int{0, 1, 5}},
+		{"negation", "-sel:all,+sel:!audio", nil, []int{0, 1, 7, 8, 9}},
+		{"and binds tighter than or", "-sel:all,+sel:subtitle|audio&multi", nil, []int{2, 3, 7, 8, 9}},
+		{"later rules win", "-sel:all,+sel:audio,-sel:lossy,+sel:stereo", nil, []int{2, 4, 5, 6}},
+		{"unknown token matches nothing", "-sel:bogus,-sel:(audio&bogus)", nil, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"weight rules are ignored", "-sel:all,+sel:video,=100:all,+10:favlang,-5:audio", []string{"eng"}, []int{0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keptIDs(EvaluateSelection(tt.selection, selectionTitle, tt.favlangs)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateSelection(%q) kept %v, want %v", tt.selection, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSelection(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile Profile
+		want    string
+		kept    []int
+	}{
+		{
+			name:    "all",
+			profile: Profile{},
+			want:    "-sel:all,+sel:video,+sel:audio,+sel:subtitle,-sel:mvcvideo",
+			kept:    []int{0, 2, 3, 4, 5, 6, 7, 8, 9},
+		},
+		{
+			name:    "english with untagged and no core",
+			profile: Profile{Audio: []string{"eng"}, Subtitle: []string{"eng"}, NoLang: true, DropCore: true},
+			want:    "-sel:all,+sel:video,+sel:(audio&(eng)),+sel:(subtitle&(eng)),+sel:((audio|subtitle)&nolang),-sel:core,-sel:mvcvideo",
+			kept:    []int{0, 2, 4, 6, 7, 9},
+		},
+		{
+			name:    "3d with rules",
+			profile: Profile{Audio: []string{"ENG", "fra"}, Subtitle: []string{"all"}, KeepMVC: true, Rules: []string{"-sel:havemulti", " "}},
+			want:    "-sel:all,+sel:video,+sel:(audio&(eng|fra)),+sel:subtitle,-sel:havemulti",
+			kept:    []int{0, 1, 2, 3, 5, 7, 8, 9},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompileSelection(tt.profile)
+			if got != tt.want {
+				t.Fatalf("CompileSelection = %q, want %q", got, tt.want)
+			}
+			if kept := keptIDs(EvaluateSelection(got, selectionTitle, nil)); !reflect.DeepEqual(kept, tt.kept) {
+				t.Errorf("%q kept %v, want %v", got, kept, tt.kept)
+			}
+		})
+	}
+}
+
+func keptIDs(kept map[int]bool) []int {
+	var ids []int
+	for id, ok := range kept {
+		if ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func TestExpandFavlang(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []string
+		favlangs []string
+		want     []string
+		wantErr  bool
+	}{
+		{"no favlang", []string{"-sel:mono"}, nil, []string{"-sel:mono"}, false},
+		{"one language", []string{"+sel:(audio&favlang)"}, []string{"eng"}, []string{"+sel:(audio&(eng))"}, false},
+		{"several languages", []string{"-sel:!favlang&subtitle", "-sel:core"}, []string{"ENG", " jpn"}, []string{"-sel:!(eng|jpn)&subtitle", "-sel:core"}, false},
+		{"favlang without preferred languages", []string{"+sel:favlang"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandFavlang(tt.rules, tt.favlangs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandFavlang error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandFavlang = %q, want %q", got, tt.want)
+			}
+			// The expanded rules select the same streams without the preferred languages.
+			if err == nil && len(tt.favlangs) > 0 {
+				selection := "-sel:all," + strings.Join(tt.rules, ",")
+				expanded := "-sel:all," + strings.Join(got, ",")
+				if a, b := EvaluateSelection(selection, selectionTitle, tt.favlangs), EvaluateSelection(expanded, selectionTitle, nil); !reflect.DeepEqual(a, b) {
+					t.Errorf("%q keeps %v, expanded %q keeps %v", selection, keptIDs(a), expanded, keptIDs(b))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const seriesTemplate = "{{.Series}}/Season {{.Season}}/{{.Series}} - S{{.Season}}E{{.Episode}}.mkv"
+
+type EpisodeRecord struct {
+	Playlist string `json:"playlist"`
+	Duration string `json:"duration"`
+	Bytes    int64  `json:"bytes"`
+	Episode  int    `json:"episode"`
+}
+
+type SeasonState struct {
+	NextEpisode int                        `json:"next_episode"`
+	Discs       map[string][]EpisodeRecord `json:"discs"` // keyed by disc volume label and name
+}
+
+// SeriesState carries episode numbering across the discs of a set. It lives in the output directory,
+// keyed by series and season.
+type SeriesState struct {
+	path    string
+	Seasons map[string]*SeasonState `json:"seasons"`
+}
+
+func seriesKey(series string, season int) string {
+	return fmt.Sprintf("%s|S%02d", series, season)
+}
+
+func discKey(disc Disc) string {
+	return disc.Volume + "|" + disc.Name
+}
+
+func LoadSeriesState(outDir string) (*SeriesState, error) {
+	state := &SeriesState{path: filepath.Join(outDir, ".ripmkv-series.json"), Seasons: map[string]*SeasonState{}}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Seasons == nil {
+		state.Seasons = map[string]*SeasonState{}
+	}
+	return state, nil
+}
+
+// seriesMu serializes series state updates within the process; lockSeriesState extends that to other
+// processes.
+var seriesMu sync.Mutex
+
+// lockSeriesState locks the series state of an output directory from load to save. Rips of several drives
+// sharing an output directory would otherwise read the same next episode and hand out the same numbers.
+func lockSeriesState(outDir string) (func(), error) {
+	seriesMu.Lock()
+	lock, err := lockFile(filepath.Join(outDir, ".ripmkv-series.json.lock"), true)
+	if err != nil {
+		seriesMu.Unlock()
+		return nil, err
+	}
+	return func() {
+		unlockFile(lock)
+		seriesMu.Unlock()
+	}, nil
+}
+
+func (s *SeriesState) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// episodeOrder sorts titles into episode order: an explicit track order from --episode-order or the
+// config's per-disc override, otherwise playlist order, falling back to title order.
+func episodeOrder(titles []Title, disc Disc, args Arguments, config Config) []Title {
+	ordered := append([]Title(nil), titles...)
+
+	order := parseTrackList(args.EpisodeOrder)
+	if len(order) == 0 {
+		order = config.EpisodeOrder[disc.Volume]
+	}
+	if len(order) > 0 {
+		position := func(t Title) int {
+			if i := slices.Index(order, t.ID); i >= 0 {
+				return i
+			}
+			return len(order) + t.ID
+		}
+		sort.SliceStable(ordered, func(i, j int) bool { return position(ordered[i]) < position(ordered[j]) })
+		return ordered
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].Playlist != ordered[j].Playlist && ordered[i].Playlist != "" && ordered[j].Playlist != "" {
+			return ordered[i].Playlist < ordered[j].Playlist
+		}
+		return ordered[i].ID < ordered[j].ID
+	})
+	return ordered
+}
+
+func parseTrackList(values []string) []int {
+	var ids []int
+	for _, value := range values {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			fmt.Println("Invalid track number:", value)
+			os.Exit(1)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// AssignEpisodes numbers the titles of a disc, continuing from the previous disc of the season.
+// A disc that was numbered before gets its recorded numbers back, so re-rips keep their names.
+func (s *SeriesState) AssignEpisodes(series string, season int, disc Disc, titles []Title, args Arguments, config Config) map[int]int {
+	key := seriesKey(series, season)
+	state, ok := s.Seasons[key]
+	if !ok {
+		state = &SeasonState{NextEpisode: 1, Discs: map[string][]EpisodeRecord{}}
+		s.Seasons[key] = state
+	}
+	if args.FirstEpisode > 0 {
+		state.NextEpisode = args.FirstEpisode
+	}
+
+	episodes := map[int]int{}
+	records := state.Discs[discKey(disc)]
+	for _, t := range episodeOrder(titles, disc, args, config) {
+		recorded := false
+		for _, r := range records {
+			if r.Playlist == t.Playlist && r.Duration == t.Duration && r.Bytes == t.Bytes {
+				episodes[t.ID] = r.Episode
+				recorded = true
+			}
+		}
+		if recorded && args.FirstEpisode == 0 {
+			continue
+		}
+
+		episodes[t.ID] = state.NextEpisode
+		records = filter(records, func(r EpisodeRecord) bool {
+			return !(r.Playlist == t.Playlist && r.Duration == t.Duration && r.Bytes == t.Bytes)
+		})
+		records = append(records, EpisodeRecord{Playlist: t.Playlist, Duration: t.Duration, Bytes: t.Bytes, Episode: state.NextEpisode})
+		state.NextEpisode++
+	}
+	state.Discs[discKey(disc)] = records
+
+	return episodes
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func seriesDisc(volume string, playlists ...string) Disc {
+	disc := Disc{Name: "Show", Volume: volume}
+	for i, playlist := range playlists {
+		disc.Titles = append(disc.Titles, Title{ID: i, Playlist: playlist, Duration: "0:42:00", Bytes: int64(1000 + i)})
+	}
+	return disc
+}
+
+func TestAssignEpisodes(t *testing.T) {
+	disc1 := seriesDisc("SHOW_S1_D1", "00802.mpls", "00800.mpls", "00801.mpls") // playlist order differs from title order
+	disc2 := seriesDisc("SHOW_S1_D2", "00100.mpls", "00101.mpls")
+	disc3 := seriesDisc("SHOW_S1_D3", "00100.mpls", "00101.mpls")
+	disc4 := seriesDisc("SHOW_S1_D4", "00100.mpls", "00101.mpls", "00102.mpls")
+	disc5 := seriesDisc("SHOW_S1_D5", "00100.mpls", "00101.mpls", "00102.mpls")
+	config := Config{EpisodeOrder: map[string][]int{"SHOW_S1_D5": {1, 0}}}
+
+	// The steps run in order against one state, like the discs of a set ripped one after another.
+	steps := []struct {
+		name   string
+		disc   Disc
+		season int
+		args   Arguments
+		want   map[int]int
+		next   int
+	}{
+		{"first disc in playlist order", disc1, 1, Arguments{}, map[int]int{1: 1, 2: 2, 0: 3}, 4},
+		{"second disc continues", disc2, 1, Arguments{}, map[int]int{0: 4, 1: 5}, 6},
+		{"re-rip keeps its numbers", disc1, 1, Arguments{}, map[int]int{1: 1, 2: 2, 0: 3}, 6},
+		{"first episode", disc3, 1, Arguments{FirstEpisode: 10}, map[int]int{0: 10, 1: 11}, 12},
+		{"re-rip with first episode renumbers", disc1, 1, Arguments{FirstEpisode: 20}, map[int]int{1: 20, 2: 21, 0: 22}, 23},
+		{"episode order", disc4, 1, Arguments{EpisodeOrder: []string{"2", "0"}}, map[int]int{2: 23, 0: 24, 1: 25}, 26},
+		{"config episode order", disc5, 1, Arguments{}, map[int]int{1: 26, 0: 27, 2: 28}, 29},
+		{"other season starts at one", disc2, 2, Arguments{}, map[int]int{0: 1, 1: 2}, 3},
+	}
+
+	state, err := LoadSeriesState(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range steps {
+		got := state.AssignEpisodes("Show", step.season, step.disc, step.disc.Titles, step.args, config)
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: episodes %v, want %v", step.name, got, step.want)
+		}
+		if next := state.Seasons[seriesKey("Show", step.season)].NextEpisode; next != step.next {
+			t.Errorf("%s: next episode %d, want %d", step.name, next, step.next)
+		}
+	}
+}
+
+func TestSeriesStateSave(t *testing.T) {
+	dir := t.TempDir()
+	disc1 := seriesDisc("SHOW_S1_D1", "00800.mpls", "00801.mpls")
+	disc2 := seriesDisc("SHOW_S1_D2", "00800.mpls", "00801.mpls")
+
+	state, err := LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.AssignEpisodes("Show", 1, disc1, disc1.Titles, Arguments{}, Config{})
+	if err := state.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err = LoadSeriesState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := state.AssignEpisodes("Show", 1, disc1, disc1.Titles, Arguments{}, Config{}), (map[int]int{0: 1, 1: 2}); !reflect.DeepEqual(got, want) {
+		t.Errorf("re-rip after reload: episodes %v, want %v", got, want)
+	}
+	if got, want := state.AssignEpisodes("Show", 1, disc2, disc2.Titles, Arguments{}, Config{}), (map[int]int{0: 3, 1: 4}); !reflect.DeepEqual(got, want) {
+		t.Errorf("next disc after reload: episodes %v, want %v", got, want)
+	}
+}
+
+func TestSeriesStateLock(t *testing.T) {
+	dir := t.TempDir()
+	const discs = 8
+
+	// Each goroutine numbers a disc of its own the way outputNamer does.
+	episodes := make(chan int, discs*2)
+	var wg sync.WaitGroup
+	for i := 0; i < discs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			disc := seriesDisc(fmt.Sprintf("SHOW_S1_D%d", i), "00800.mpls", "00801.mpls")
+			unlock, err := lockSeriesState(dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+			state, err := LoadSeriesState(dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, episode := range state.AssignEpisodes("Show", 1, disc, disc.Titles, Arguments{}, Config{}) {
+				episodes <- episode
+			}
+			if err := state.Save(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(episodes)
+
+	seen := map[int]bool{}
+	for episode := range episodes {
+		if seen[episode] {
+			t.Errorf("episode %d handed out twice", episode)
+		}
+		seen[episode] = true
+	}
+	if len(seen) != discs*2 {
+		t.Errorf("%d episodes numbered, want %d", len(seen), discs*2)
+	}
+}
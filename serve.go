@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// workerKey groups jobs that must not run at the same time: jobs on a drive run one after the other,
+// backup sources share the backup workers. Drives are keyed by their device, so dev:/dev/cdrom, dev:/dev/sr0
+// and disc:0 queue behind each other when they are the same drive.
+func workerKey(source string) string {
+	if strings.HasPrefix(source, "file:") || strings.HasPrefix(source, "iso:") {
+		return "backups"
+	}
+	if device, _, ok := driveLockPath(source); ok {
+		return device
+	}
+	return source
+}
+
+func jobLog(dir string, id int) string {
+	return filepath.Join(dir, "logs", fmt.Sprintf("job-%d.log", id))
+}
+
+// jobSource resolves -d to the makemkvcon source the job will use, with backup paths made absolute so the
+// daemon finds them from any directory.
+func jobSource(args Arguments) string {
+	source := discSource(args)
+	for _, prefix := range []string{"file:", "iso:"} {
+		if path, ok := strings.CutPrefix(source, prefix); ok {
+			if abs, err := filepath.Abs(path); err == nil {
+				return prefix + abs
+			}
+		}
+	}
+	return source
+}
+
+// SubmitJob queues a rip with the arguments following "submit".
+func SubmitJob(args Arguments, config Config) {
+	if args.Drive == "" {
+		fmt.Println("Drive not specified. Use -d or --drive to specify the drive or backup to rip.")
+		os.Exit(1)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var id int
+	err = withQueue(serveStateDir(config), func(q *Queue) error {
+		id = q.NextID
+		q.NextID++
+		q.Jobs = append(q.Jobs, &Job{
+			ID:        id,
+			Source:    jobSource(args),
+			Args:      append([]string(nil), os.Args[2:]...),
+			Dir:       cwd,
+			Status:    "queued",
+			Submitted: time.Now().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error writing job queue:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Queued job %d for %s\n", id, jobSource(args))
+}
+
+func ListJobs(config Config) {
+	dir := serveStateDir(config)
+	var jobs []*Job
+	err := withQueue(dir, func(q *Queue) error {
+		jobs = q.Jobs
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error reading job queue:", err)
+		os.Exit(1)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs.")
+		return
+	}
+
+	fmt.Printf("%-5s  %-10s  %-19s  %s\n", "ID", "STATUS", "SUBMITTED", "SOURCE")
+	for _, job := range jobs {
+		status := job.Status
+		if job.Cancel && status == "running" {
+			status = "cancelling"
+		}
+		fmt.Printf("%-5d  %-10s  %-19s  %s\n", job.ID, status, job.Submitted.Local().Format("2006-01-02 15:04:05"), job.Source)
+		fmt.Printf("       %s\n", shellJoin(append([]string{"ripmkv"}, job.Args...)))
+		if job.Error != "" {
+			fmt.Printf("       %s\n", job.Error)
+		}
+		if job.Status != "queued" {
+			fmt.Printf("       log: %s\n", jobLog(dir, job.ID))
+		}
+	}
+}
+
+// CancelJobs cancels queued jobs right away and asks the daemon to interrupt running ones.
+func CancelJobs(args Arguments, config Config) {
+	if len(args.Paths) == 0 {
+		fmt.Println("No job specified. Usage: ripmkv cancel <id>...")
+		os.Exit(1)
+	}
+	var ids []int
+	for _, value := range args.Paths {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			fmt.Println("Invalid job id:", value)
+			os.Exit(1)
+		}
+		ids = append(ids, id)
+	}
+
+	failed := false
+	err := withQueue(serveStateDir(config), func(q *Queue) error {
+		for _, id := range ids {
+			job := q.Find(id)
+			switch {
+			case job == nil:
+				fmt.Printf("Job %d not found.\n", id)
+				failed = true
+			case job.Status == "queued":
+				now := time.Now().UTC()
+				job.Status, job.Finished = "cancelled", &now
+				fmt.Printf("Cancelled job %d.\n", id)
+			case job.Status == "running":
+				job.Cancel = true
+				fmt.Printf("Cancelling job %d, the daemon will stop it.\n", id)
+			default:
+				fmt.Printf("Job %d already %s.\n", id, job.Status)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error writing job queue:", err)
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lockInstance makes sure only one process runs a command, such as serve, on a state directory. It writes
+// its pid next to the lock so the error can name the process already running.
+func lockInstance(dir string, name string) (*os.File, error) {
+	lock, err := lockFile(filepath.Join(dir, name+".lock"), false)
+	if errors.Is(err, errLocked) {
+		pid, _ := os.ReadFile(filepath.Join(dir, name+".pid"))
+		return nil, fmt.Errorf("%s is already running (pid %s)", name, strings.TrimSpace(string(pid)))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, name+".pid"), []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		unlockFile(lock)
+		return nil, err
+	}
+	return lock, nil
+}
+
+type jobExit struct {
+	ID  int
+	Err error
+}
+
+// Serve runs the job queue: one worker per drive, a shared pool for backup sources, and the io and
+// transcode slots shared by every job. Jobs run as ripmkv child processes logging to the state directory.
+// Stopping the daemon interrupts running jobs and puts them back in the queue to resume on the next start.
+func Serve(ctx context.Context, config Config) error {
+	dir := serveStateDir(config)
+	for _, sub := range []string{"logs", "slots"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return err
+		}
+	}
+
+	lock, err := lockInstance(dir, "serve")
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// Jobs left running by a daemon that died go back to the queue.
+	if err := withQueue(dir, func(q *Queue) error {
+		for _, job := range q.Jobs {
+			if job.Status == "running" {
+				requeue(job)
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("error reading job queue: %w", err)
+	}
+
+	backupWorkers := config.Serve.BackupWorkers
+	if backupWorkers <= 0 {
+		backupWorkers = 1
+	}
+	env := append(os.Environ(),
+		envSlotsDir+"="+filepath.Join(dir, "slots"),
+		envIOSlots+"="+strconv.Itoa(max(config.Serve.IOSlots, 1)),
+		envTranscodeSlots+"="+strconv.Itoa(max(config.Serve.TranscodeSlots, 1)),
+	)
+
+	running := map[int]*exec.Cmd{}
+	interrupted := map[int]bool{}
+	exits := make(chan jobExit)
+	fmt.Printf("Serving the job queue in %s\n", dir)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		err := withQueue(dir, func(q *Queue) error {
+			busy := map[string]int{}
+			for _, job := range q.Jobs {
+				if job.Status != "running" {
+					continue
+				}
+				busy[workerKey(job.Source)]++
+				if cmd := running[job.ID]; cmd != nil && job.Cancel && !interrupted[job.ID] {
+					cmd.Process.Signal(os.Interrupt)
+					interrupted[job.ID] = true
+				}
+			}
+
+			for _, job := range q.Jobs {
+				key := workerKey(job.Source)
+				limit := 1
+				if key == "backups" {
+					limit = backupWorkers
+				}
+				if job.Status != "queued" || busy[key] >= limit {
+					continue
+				}
+				cmd, err := startJob(exe, dir, job, env, exits)
+				if err != nil {
+					now := time.Now().UTC()
+					job.Status, job.Error, job.Finished = "failed", err.Error(), &now
+					continue
+				}
+				running[job.ID] = cmd
+				busy[key]++
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Error updating job queue:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			stopJobs(dir, running, exits)
+			return nil
+		case exit := <-exits:
+			delete(running, exit.ID)
+			delete(interrupted, exit.ID)
+			finishJob(dir, exit)
+		case <-ticker.C:
+		}
+	}
+}
+
+func startJob(exe string, dir string, job *Job, env []string, exits chan<- jobExit) (*exec.Cmd, error) {
+	log, err := os.OpenFile(jobLog(dir, job.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, job.Args...)
+	cmd.Dir = job.Dir
+	cmd.Env = env
+	cmd.Stdout = log
+	cmd.Stderr = log
+	fmt.Fprintf(log, "=== %s %s\n", time.Now().Format(time.RFC3339), shellJoin(append([]string{"ripmkv"}, job.Args...)))
+	if err := cmd.Start(); err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	job.Status, job.PID, job.Started, job.Finished, job.Error = "running", cmd.Process.Pid, &now, nil, ""
+	job.Attempts++
+	fmt.Printf("Started job %d on %s (pid %d)\n", job.ID, job.Source, job.PID)
+	go func() {
+		err := cmd.Wait()
+		log.Close()
+		exits <- jobExit{ID: job.ID, Err: err}
+	}()
+	return cmd, nil
+}
+
+func finishJob(dir string, exit jobExit) {
+	err := withQueue(dir, func(q *Queue) error {
+		job := q.Find(exit.ID)
+		if job == nil {
+			return nil
+		}
+		now := time.Now().UTC()
+		job.Finished, job.PID = &now, 0
+		switch {
+		case job.Cancel:
+			job.Status, job.Error = "cancelled", ""
+		case exit.Err != nil:
+			job.Status, job.Error = "failed", exit.Err.Error()
+		default:
+			job.Status, job.Error = "done", ""
+		}
+		fmt.Printf("Job %d %s\n", job.ID, job.Status)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error updating job queue:", err)
+	}
+}
+
+// stopJobs interrupts the running jobs, waits for them to clean up and queues them again.
+func stopJobs(dir string, running map[int]*exec.Cmd, exits <-chan jobExit) {
+	if len(running) == 0 {
+		return
+	}
+	fmt.Printf("Stopping %d running job(s)...\n", len(running))
+	for _, cmd := range running {
+		cmd.Process.Signal(os.Interrupt)
+	}
+	var stopped []int
+	for len(running) > 0 {
+		exit := <-exits
+		delete(running, exit.ID)
+		stopped = append(stopped, exit.ID)
+	}
+	err := withQueue(dir, func(q *Queue) error {
+		for _, job := range q.Jobs {
+			if !slices.Contains(stopped, job.ID) {
+				continue
+			}
+			if job.Cancel {
+				now := time.Now().UTC()
+				job.Status, job.Finished, job.PID = "cancelled", &now, 0
+			} else {
+				requeue(job)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error updating job queue:", err)
+	}
+}
+
+// requeue puts an interrupted job back in the queue. It resumes, skipping the titles it already ripped.
+func requeue(job *Job) {
+	job.Status, job.PID, job.Started = "queued", 0, nil
+	if !slices.Contains(job.Args, "--resume") {
+		job.Args = append(job.Args, "--resume")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+var errLocked = errors.New("locked by another process")
+
+const (
+	SlotIO        = "io"        // post-processing and finalizing of ripped files
+	SlotTranscode = "transcode" // transcodes
+)
+
+// Jobs started by serve find the shared slots through these variables.
+const (
+	envSlotsDir       = "RIPMKV_SLOTS_DIR"
+	envIOSlots        = "RIPMKV_IO_SLOTS"
+	envTranscodeSlots = "RIPMKV_TRANSCODE_SLOTS"
+)
+
+// acquireSlot takes one of the slots of a kind that serve shares between its jobs, waiting until one is
+// free. Slots are lock files, so a job that dies frees its slot. Outside of serve there are no caps.
+func acquireSlot(ctx context.Context, kind string) (func(), error) {
+	dir := os.Getenv(envSlotsDir)
+	if dir == "" {
+		return func() {}, nil
+	}
+	env := envIOSlots
+	if kind == SlotTranscode {
+		env = envTranscodeSlots
+	}
+	slots, _ := strconv.Atoi(os.Getenv(env))
+	if slots <= 0 {
+		slots = 1
+	}
+
+	waiting := false
+	for {
+		for i := 0; i < slots; i++ {
+			f, err := lockFile(filepath.Join(dir, fmt.Sprintf("%s-%d.lock", kind, i)), false)
+			if errors.Is(err, errLocked) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			return func() { unlockFile(f) }, nil
+		}
+		if !waiting {
+			fmt.Printf("Waiting for a free %s slot...\n", kind)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+var defaultOCRCommand = []string{"subtile-ocr", "--lang", "{{.Lang}}", "--output", "{{.Output}}", "{{.Input}}"}
+
+// ocrData is what the OCR command's arguments are executed against.
+type ocrData struct {
+	Input  string // the .sup or .idx sidecar
+	Output string // the .srt to write
+	Lang   string // ISO 639-2/T code as used by tesseract, e.g. "fra"
+	Forced bool
+}
+
+// classifySubtitles marks forced and SDH subtitle streams.
+// Forced comes from makemkv's forced-subtitles stream flag, or the description of the derived
+// "forced only" stream. SDH comes from the description alone: makemkv has no stream flag for it, and
+// a second stream in the same language is as often commentary as SDH, so ordering proves nothing.
+func classifySubtitles(list []Subtitles) {
+	for i := range list {
+		s := &list[i]
+		desc := strings.ToLower(s.Description)
+
+		s.Forced = s.Flags&FlagForcedSubtitles != 0 || strings.Contains(desc, "forced")
+		if s.Forced {
+			continue
+		}
+		s.SDH = strings.Contains(desc, "sdh") || strings.Contains(desc, "hoh") || strings.Contains(desc, "hearing")
+	}
+}
+
+func subtitleTrackName(s Subtitles) string {
+	name := firstNonEmpty(s.Language, s.LanguageCode)
+	if name == "?" {
+		name = "Unknown"
+	}
+	switch {
+	case s.Forced:
+		return name + " (Forced)"
+	case s.SDH:
+		return name + " (SDH)"
+	default:
+		return name
+	}
+}
+
+func subtitleKind(s Subtitles) string {
+	switch {
+	case s.Forced:
+		return "forced"
+	case s.SDH:
+		return "sdh"
+	default:
+		return "full"
+	}
+}
+
+func boolFlag(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// sidecarExtension returns the extension mkvextract should write a subtitle codec to. VobSub is given as
+// .idx, mkvextract writes the .sub next to it.
+func sidecarExtension(codecID string) string {
+	switch {
+	case codecID == "S_HDMV/PGS":
+		return ".sup"
+	case codecID == "S_VOBSUB":
+		return ".idx"
+	case codecID == "S_TEXT/ASS" || codecID == "S_ASS":
+		return ".ass"
+	case codecID == "S_TEXT/SSA" || codecID == "S_SSA":
+		return ".ssa"
+	case strings.HasPrefix(codecID, "S_TEXT/"):
+		return ".srt"
+	default:
+		return ""
+	}
+}
+
+func isImageSubtitle(codecID string) bool {
+	return codecID == "S_HDMV/PGS" || codecID == "S_VOBSUB"
+}
+
+// subtitleSidecarBase returns "<file>.<lang>[.forced][.sdh]" for a subtitle stream. A stream that would
+// collide with an earlier one of the same language and kind gets a counter, e.g. "<file>.eng.2".
+func subtitleSidecarBase(file string, s Subtitles, used map[string]int) string {
+	base := strings.TrimSuffix(file, filepath.Ext(file)) + "." + normalizeLang(s.LanguageCode)
+	if s.Forced {
+		base += ".forced"
+	}
+	if s.SDH {
+		base += ".sdh"
+	}
+	used[base]++
+	if n := used[base]; n > 1 {
+		base += fmt.Sprintf(".%d", n)
+	}
+	return base
+}
+
+func keptSubtitles(t Title, profile Profile, config Config) []Subtitles {
+	kept := SelectStreams(profile, t, config.PreferredLanguages)
+	subs := filter(append([]Subtitles(nil), t.Subtitles...), func(s Subtitles) bool { return kept[s.StreamID] })
+	sort.Slice(subs, func(i, j int) bool { return subs[i].StreamID < subs[j].StreamID })
+	return subs
+}
+
+// subtitleExtractArgs returns the mkvextract arguments that write each subtitle to its sidecar, the sidecar
+// of each subtitle by index, and every file mkvextract will write. argv is nil when no codec is supported.
+func subtitleExtractArgs(file string, subs []Subtitles, trackIDs []int) ([]string, map[int]string, []string) {
+	var written []string
+	argv := []string{file, "tracks"}
+	sidecars := map[int]string{}
+	used := map[string]int{}
+	for i, s := range subs {
+		ext := sidecarExtension(s.CodecID)
+		if ext == "" {
+			fmt.Printf("Skipping subtitle track %d of %s, unsupported codec %s\n", trackIDs[i], file, s.CodecID)
+			continue
+		}
+		sidecar := subtitleSidecarBase(file, s, used) + ext
+		sidecars[i] = sidecar
+		argv = append(argv, fmt.Sprintf("%d:%s", trackIDs[i], sidecar))
+		written = append(written, sidecar)
+		if ext == ".idx" {
+			written = append(written, strings.TrimSuffix(sidecar, ext)+".sub")
+		}
+	}
+	if len(sidecars) == 0 {
+		return nil, nil, nil
+	}
+	return argv, sidecars, written
+}
+
+// exportSubtitles extracts every kept subtitle track of a finished output to sidecar files next to it,
+// and OCRs image subtitles to .srt when asked. It returns the files written.
+func exportSubtitles(file string, t Title, profile Profile, ocr bool, config Config) ([]string, error) {
+	subs := keptSubtitles(t, profile, config)
+	if len(subs) == 0 {
+		return nil, nil
+	}
+
+	info, err := inspectMKV(file)
+	if err != nil {
+		return nil, err
+	}
+	tracks := info.TracksOfType("subtitles")
+	if len(tracks) != len(subs) {
+		return nil, fmt.Errorf("%s has %d subtitle track(s), expected %d", file, len(tracks), len(subs))
+	}
+
+	trackIDs := make([]int, len(tracks))
+	for i, track := range tracks {
+		trackIDs[i] = track.ID
+	}
+	argv, sidecars, written := subtitleExtractArgs(file, subs, trackIDs)
+	if argv == nil {
+		return nil, nil
+	}
+
+	mkvextract := exec.Command("mkvextract", argv...)
+	if output, err := mkvextract.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("mkvextract: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	if !ocr {
+		return written, nil
+	}
+
+	var failed []string
+	for i, s := range subs {
+		sidecar, ok := sidecars[i]
+		if !ok || !isImageSubtitle(s.CodecID) {
+			continue
+		}
+		srt := ocrOutput(sidecar)
+		if err := ocrSubtitle(sidecar, srt, s, config); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", filepath.Base(sidecar), err))
+			continue
+		}
+		written = append(written, srt)
+	}
+	if len(failed) > 0 {
+		return written, fmt.Errorf("OCR failed for %s", strings.Join(failed, "; "))
+	}
+	return written, nil
+}
+
+func ocrOutput(sidecar string) string {
+	return strings.TrimSuffix(sidecar, filepath.Ext(sidecar)) + ".srt"
+}
+
+// ocrSubtitle runs the configured OCR engine over an image subtitle sidecar.
+func ocrSubtitle(input string, output string, s Subtitles, config Config) error {
+	argv, err := ocrArgs(input, output, s, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Running OCR on %s...\n", filepath.Base(input))
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, lastLine(string(output)))
+	}
+	if _, err := os.Stat(output); err != nil {
+		return fmt.Errorf("%s wrote no %s", argv[0], filepath.Base(output))
+	}
+	return nil
+}
+
+// ocrArgs renders the configured OCR command for a sidecar.
+func ocrArgs(input string, output string, s Subtitles, config Config) ([]string, error) {
+	command := config.OCR.Command
+	if len(command) == 0 {
+		command = defaultOCRCommand
+	}
+	data := ocrData{Input: input, Output: output, Lang: terminologyLang(normalizeLang(s.LanguageCode)), Forced: s.Forced}
+
+	argv := make([]string, len(command))
+	for i, arg := range command {
+		tmpl, err := template.New("ocr").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OCR command: %w", err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("invalid OCR command: %w", err)
+		}
+		argv[i] = b.String()
+	}
+	return argv, nil
+}
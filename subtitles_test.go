@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestClassifySubtitles(t *testing.T) {
+	tests := []struct {
+		name   string
+		subs   []Subtitles
+		forced []bool
+		sdh    []bool
+	}{
+		{"forced flag", []Subtitles{{LanguageCode: "eng"}, {LanguageCode: "eng", Flags: FlagForcedSubtitles}},
+			[]bool{false, true}, []bool{false, false}},
+		{"derived forced only stream", []Subtitles{{LanguageCode: "eng"}, {LanguageCode: "eng", Flags: FlagDerivedStream, Description: "Forced only"}},
+			[]bool{false, true}, []bool{false, false}},
+		{"derived stream without forced", []Subtitles{{LanguageCode: "eng"}, {LanguageCode: "eng", Flags: FlagDerivedStream}},
+			[]bool{false, false}, []bool{false, false}},
+		{"sdh description", []Subtitles{{LanguageCode: "eng"}, {LanguageCode: "eng", Description: "English SDH"}, {LanguageCode: "eng", Description: "for the Hearing Impaired"}},
+			[]bool{false, false, false}, []bool{false, true, true}},
+		{"second stream of a language is not sdh", []Subtitles{{LanguageCode: "eng"}, {LanguageCode: "eng"}, {LanguageCode: "fra"}},
+			[]bool{false, false, false}, []bool{false, false, false}},
+		{"forced sdh is forced", []Subtitles{{LanguageCode: "eng", Flags: FlagForcedSubtitles, Description: "SDH"}},
+			[]bool{true}, []bool{false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs := append([]Subtitles(nil), tt.subs...)
+			classifySubtitles(subs)
+			for i, s := range subs {
+				if s.Forced != tt.forced[i] || s.SDH != tt.sdh[i] {
+					t.Errorf("subtitle %d: forced %v, sdh %v, want forced %v, sdh %v", i, s.Forced, s.SDH, tt.forced[i], tt.sdh[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSubtitleTrackName(t *testing.T) {
+	tests := []struct {
+		sub  Subtitles
+		want string
+	}{
+		{Subtitles{Language: "English", LanguageCode: "eng"}, "English"},
+		{Subtitles{Language: "English", LanguageCode: "eng", Forced: true}, "English (Forced)"},
+		{Subtitles{LanguageCode: "eng", SDH: true}, "eng (SDH)"},
+		{Subtitles{Language: "?"}, "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := subtitleTrackName(tt.sub); got != tt.want {
+			t.Errorf("subtitleTrackName(%+v) = %q, want %q", tt.sub, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type simpleTag struct {
+	Name  string
+	Value string
+}
+
+// provenanceTags describe where a rip came from, so a library file can be traced back to its disc and title.
+func provenanceTags(disc Disc, t Title, ripped time.Time) []simpleTag {
+	tags := []simpleTag{
+		{"DISC_NAME", disc.Name},
+		{"DISC_TYPE", disc.Type},
+		{"DISC_VOLUME_LABEL", disc.Volume},
+		{"SOURCE_PLAYLIST", t.Playlist},
+		{"SOURCE_TITLE_ID", strconv.Itoa(t.ID)},
+		{"SOURCE_SEGMENT_MAP", t.Segments},
+		{"DATE_ENCODED", ripped.UTC().Format("2006-01-02 15:04:05")},
+		{"ENCODER", "ripmkv " + VERSION},
+	}
+	if disc.MakeMKV != "" {
+		tags = append(tags, simpleTag{"MAKEMKV_VERSION", disc.MakeMKV})
+	}
+	return filter(tags, func(tag simpleTag) bool { return tag.Value != "" })
+}
+
+func writeTagsXML(path string, tags []simpleTag) error {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n")
+	b.WriteString("<!DOCTYPE Tags SYSTEM \"matroskatags.dtd\">\n")
+	b.WriteString("<Tags>\n")
+	b.WriteString("  <Tag>\n")
+	b.WriteString("    <Targets />\n")
+	for _, tag := range tags {
+		b.WriteString("    <Simple>\n")
+		fmt.Fprintf(&b, "      <Name>%s</Name>\n", xmlEscape(tag.Name))
+		fmt.Fprintf(&b, "      <String>%s</String>\n", xmlEscape(tag.Value))
+		b.WriteString("    </Simple>\n")
+	}
+	b.WriteString("  </Tag>\n")
+	b.WriteString("</Tags>\n")
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// applyProvenanceTags writes the provenance tags as the global tags of a staged file.
+func applyProvenanceTags(file string, disc Disc, t Title, tmpDir string) error {
+	xml := filepath.Join(tmpDir, filepath.Base(file)+".tags.xml")
+	defer os.Remove(xml)
+	if err := writeTagsXML(xml, provenanceTags(disc, t, time.Now())); err != nil {
+		return err
+	}
+	mkvpropedit := exec.Command("mkvpropedit", file, "--tags", "global:"+xml)
+	if output, err := mkvpropedit.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkvpropedit: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -6,6 +6,47 @@ import (
 	"strings"
 )
 
+var versionRegex = regexp.MustCompile(`MakeMKV v([0-9][^ "]*)`)
+
+// MakeMKVVersion finds the version makemkvcon announces in its MSG output, e.g. "1.17.7".
+func MakeMKVVersion(input string) string {
+	if matches := versionRegex.FindStringSubmatch(input); matches != nil {
+		return matches[1]
+	}
+	return ""
+}
+
+var driveRegex = regexp.MustCompile(`^DRV:(\d+),(\d+),(\d+),(\d+),"(.*)","(.*)","(.*)"$`)
+
+type Drive struct {
+	Index  int
+	State  int    // one of the Drive* states
+	Name   string // e.g. "BD-RE HL-DT-ST BD-RE WH16NS60 1.02"
+	Disc   string // volume label of the inserted disc, e.g. "UP_USA"
+	Device string // e.g. "/dev/sr0"
+}
+
+// ParseDrives reads the DRV records makemkvcon lists before opening a source. Slots without a drive are
+// left out.
+func ParseDrives(input string) []Drive {
+	var drives []Drive
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	for scanner.Scan() {
+		matches := driveRegex.FindStringSubmatch(scanner.Text())
+		if matches == nil || atoi(matches[2]) == DriveNoDrive || matches[7] == "" {
+			continue
+		}
+		drives = append(drives, Drive{
+			Index:  atoi(matches[1]),
+			State:  atoi(matches[2]),
+			Name:   matches[5],
+			Disc:   matches[6],
+			Device: matches[7],
+		})
+	}
+	return drives
+}
+
 var regex = regexp.MustCompile(`^(CINFO|TINFO|SINFO):([\d]+)(?:,([\d]+))?(?:,([\d]+))?,\d+,"(.*)"$`)
 
 type Record string
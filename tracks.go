@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+func audioTrackName(a Audio) string {
+	name := firstNonEmpty(a.Language, a.LanguageCode)
+	if name == "?" {
+		name = "Unknown"
+	}
+	name = fmt.Sprintf("%s – %s %s", name, firstNonEmpty(a.CodecLong, a.CodecShort, a.CodecID), formatChannels(a.Channels))
+	if a.Class != "" && a.Class != AudioMain {
+		name += " (" + strings.ToUpper(a.Class[:1]) + a.Class[1:] + ")"
+	}
+	return name
+}
+
+// preferenceRank orders languages by the configured preference; unlisted languages rank last.
+func preferenceRank(preferred []string, lang string) int {
+	for i, p := range preferred {
+		if sameLang(p, lang) {
+			return i
+		}
+	}
+	return len(preferred)
+}
+
+// defaultTracks picks the default audio and subtitle stream from the language preference rather
+// than the disc's flags: the best-ranked main audio, and a subtitle only when it is needed, i.e. the
+// forced track of that audio language, or a full track when the audio isn't in the top language.
+// A stream ID of -1 means no default.
+func defaultTracks(audio []Audio, subs []Subtitles, preferred []string) (int, int) {
+	defaultAudio, audioLang, bestRank := -1, "", len(preferred)+1
+	for _, a := range audio {
+		rank := preferenceRank(preferred, normalizeLang(a.LanguageCode))
+		if a.Class != "" && a.Class != AudioMain {
+			rank += len(preferred) + 1
+		}
+		if rank < bestRank {
+			defaultAudio, audioLang, bestRank = a.StreamID, normalizeLang(a.LanguageCode), rank
+		}
+	}
+
+	for _, s := range subs {
+		if s.Forced && sameLang(normalizeLang(s.LanguageCode), audioLang) {
+			return defaultAudio, s.StreamID
+		}
+	}
+	if len(preferred) == 0 || preferenceRank(preferred, audioLang) == 0 {
+		return defaultAudio, -1
+	}
+	defaultSub, subRank := -1, len(preferred)
+	for _, s := range subs {
+		rank := preferenceRank(preferred, normalizeLang(s.LanguageCode))
+		if !s.Forced && !s.SDH && rank < subRank {
+			defaultSub, subRank = s.StreamID, rank
+		}
+	}
+	return defaultAudio, defaultSub
+}
+
+// trackPropeditArgs builds the mkvpropedit arguments that name every audio and subtitle track, fix its
+// language, set forced/SDH flags and default flags. Tracks appear in the file in source order of the
+// streams the selection kept.
+func trackPropeditArgs(file string, t Title, profile Profile, config Config) []string {
+	kept := SelectStreams(profile, t, config.PreferredLanguages)
+
+	audio := filter(append([]Audio(nil), t.Audio...), func(a Audio) bool { return kept[a.StreamID] })
+	sort.Slice(audio, func(i, j int) bool { return audio[i].StreamID < audio[j].StreamID })
+	subs := filter(append([]Subtitles(nil), t.Subtitles...), func(s Subtitles) bool { return kept[s.StreamID] })
+	sort.Slice(subs, func(i, j int) bool { return subs[i].StreamID < subs[j].StreamID })
+
+	defaultAudio, defaultSub := defaultTracks(audio, subs, config.PreferredLanguages)
+
+	argv := []string{file}
+	for i, a := range audio {
+		argv = append(argv, "--edit", fmt.Sprintf("track:a%d", i+1),
+			"--set", "name="+audioTrackName(a),
+			"--set", "flag-default="+boolFlag(a.StreamID == defaultAudio),
+			"--set", "flag-commentary="+boolFlag(a.Class == AudioCommentary),
+			"--set", "flag-visual-impaired="+boolFlag(a.Class == AudioDescriptive))
+		argv = append(argv, languageArgs(a.LanguageCode)...)
+	}
+	for i, s := range subs {
+		argv = append(argv, "--edit", fmt.Sprintf("track:s%d", i+1),
+			"--set", "name="+subtitleTrackName(s),
+			"--set", "flag-default="+boolFlag(s.StreamID == defaultSub),
+			"--set", "flag-forced="+boolFlag(s.Forced),
+			"--set", "flag-hearing-impaired="+boolFlag(s.SDH))
+		argv = append(argv, languageArgs(s.LanguageCode)...)
+	}
+	if len(argv) == 1 {
+		return nil
+	}
+	return argv
+}
+
+func languageArgs(code string) []string {
+	lang := normalizeLang(code)
+	if lang == "und" {
+		return nil
+	}
+	return []string{"--set", "language=" + matroskaLang(lang), "--set", "language-ietf=" + ietfLang(lang)}
+}
+
+// applyTrackProperties writes names, languages and flags onto the tracks of a ripped file.
+func applyTrackProperties(file string, t Title, profile Profile, config Config) error {
+	argv := trackPropeditArgs(file, t, profile, config)
+	if argv == nil {
+		return nil
+	}
+	mkvpropedit := exec.Command("mkvpropedit", argv...)
+	if out, err := mkvpropedit.CombinedOutput(); err != nil {
+		return fmt.Errorf("mkvpropedit: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// propeditTitle has English main and commentary audio, Japanese audio, and English full, forced, SDH and
+// Japanese subtitles, classified the way a scan does.
+func propeditTitle() Title {
+	t := Title{
+		Video: []Video{{StreamID: 0, CodecID: "V_MPEG4/ISO/AVC"}},
+		Audio: []Audio{
+			{StreamID: 1, CodecID: "A_TRUEHD", CodecLong: "Dolby TrueHD", Language: "English", LanguageCode: "eng", Channels: 6},
+			{StreamID: 2, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "English", LanguageCode: "eng", Channels: 2, Flags: FlagDirectorsComments},
+			{StreamID: 3, CodecID: "A_AC3", CodecLong: "Dolby Digital", Language: "Japanese", LanguageCode: "jpn", Channels: 6},
+		},
+		Subtitles: []Subtitles{
+			{StreamID: 4, CodecID: "S_HDMV/PGS", Language: "English", LanguageCode: "eng"},
+			{StreamID: 5, CodecID: "S_HDMV/PGS", Language: "English", LanguageCode: "eng", Flags: FlagForcedSubtitles | FlagDerivedStream, Description: "Forced only"},
+			{StreamID: 6, CodecID: "S_HDMV/PGS", Language: "Japanese", LanguageCode: "jpn"},
+			{StreamID: 7, CodecID: "S_HDMV/PGS", Language: "English", LanguageCode: "eng", Description: "SDH"},
+		},
+	}
+	classifyAudio(t.Audio)
+	classifySubtitles(t.Subtitles)
+	return t
+}
+
+func TestTrackPropeditArgs(t *testing.T) {
+	type props map[string]string
+	tests := []struct {
+		name      string
+		profile   Profile
+		preferred []string
+		want      map[string]props // per track, the properties checked
+	}{
+		{
+			name:      "commentary kept",
+			preferred: []string{"eng"},
+			want: map[string]props{
+				"track:a1": {"name": "English – Dolby TrueHD 5.1", "flag-default": "1", "flag-commentary": "0", "language": "eng"},
+				"track:a2": {"name": "English – Dolby Digital 2.0 (Commentary)", "flag-default": "0", "flag-commentary": "1"},
+				"track:a3": {"name": "Japanese – Dolby Digital 5.1", "flag-default": "0", "language": "jpn", "language-ietf": "ja"},
+				"track:s1": {"name": "English", "flag-default": "0", "flag-forced": "0", "flag-hearing-impaired": "0"},
+				"track:s2": {"name": "English (Forced)", "flag-default": "1", "flag-forced": "1"},
+				"track:s3": {"name": "Japanese", "flag-default": "0"},
+				"track:s4": {"name": "English (SDH)", "flag-default": "0", "flag-hearing-impaired": "1"},
+			},
+		},
+		{
+			name:      "excluded commentary shifts the later tracks",
+			profile:   Profile{ExcludeAudio: []string{AudioCommentary}},
+			preferred: []string{"jpn", "eng"},
+			want: map[string]props{
+				"track:a1": {"name": "English – Dolby TrueHD 5.1", "flag-default": "0"},
+				"track:a2": {"name": "Japanese – Dolby Digital 5.1", "flag-default": "1"},
+				"track:s1": {"name": "English", "flag-default": "0"},
+				"track:s2": {"name": "English (Forced)", "flag-default": "0"},
+				"track:s3": {"name": "Japanese", "flag-default": "0"},
+				"track:s4": {"name": "English (SDH)", "flag-default": "0"},
+			},
+		},
+		{
+			name:      "full subtitle when the audio is not the top language",
+			profile:   Profile{Audio: []string{"eng"}, Rules: []string{"-sel:forced"}},
+			preferred: []string{"fra", "eng"},
+			want: map[string]props{
+				"track:a1": {"name": "English – Dolby TrueHD 5.1", "flag-default": "1"},
+				"track:a2": {"name": "English – Dolby Digital 2.0 (Commentary)", "flag-default": "0"},
+				"track:s1": {"name": "English", "flag-default": "1"},
+				"track:s2": {"name": "Japanese", "flag-default": "0"},
+				"track:s3": {"name": "English (SDH)", "flag-default": "0", "flag-hearing-impaired": "1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv := trackPropeditArgs("out.mkv", propeditTitle(), tt.profile, Config{PreferredLanguages: tt.preferred})
+			if len(argv) == 0 || argv[0] != "out.mkv" {
+				t.Fatalf("trackPropeditArgs = %q, want the file first", argv)
+			}
+
+			got := map[string]props{}
+			var track string
+			for i := 1; i < len(argv)-1; i++ {
+				switch argv[i] {
+				case "--edit":
+					track = argv[i+1]
+					got[track] = props{}
+				case "--set":
+					key, value, _ := strings.Cut(argv[i+1], "=")
+					got[track][key] = value
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("edited tracks %v, want %v", slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(tt.want)))
+			}
+			for track, want := range tt.want {
+				for key, value := range want {
+					if got[track][key] != value {
+						t.Errorf("%s %s = %q, want %q", track, key, got[track][key], value)
+					}
+				}
+			}
+		})
+	}
+}
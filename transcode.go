@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var builtinPresets = map[string]TranscodePreset{
+	"h264-compat": {Tool: "ffmpeg", Extension: ".mp4", Args: []string{
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "medium", "-crf", "20", "-profile:v", "high", "-level", "4.1", "-pix_fmt", "yuv420p",
+		"-vf", "scale=-2:'min(1080,ih)'",
+		"-c:a", "aac", "-ac", "2", "-b:a", "160k",
+		"-movflags", "+faststart",
+	}},
+	"h265-1080p": {Tool: "ffmpeg", Args: []string{
+		"-map", "0",
+		"-c:v", "libx265", "-preset", "medium", "-crf", "22",
+		"-vf", "scale=-2:'min(1080,ih)'",
+		"-c:a", "copy", "-c:s", "copy",
+	}},
+	"h265-2160p-hdr": {Tool: "ffmpeg", Args: []string{
+		"-map", "0",
+		"-c:v", "libx265", "-preset", "slow", "-crf", "20", "-pix_fmt", "yuv420p10le",
+		"-x265-params", "hdr-opt=1:repeat-headers=1",
+		"-c:a", "copy", "-c:s", "copy",
+	}},
+}
+
+var hdrVideo = true
+
+// defaultTranscodeRules keep HDR untouched in 10-bit HEVC, shrink HD to HEVC and make SD mobile friendly.
+var defaultTranscodeRules = []TranscodeRule{
+	{HDR: &hdrVideo, Preset: "h265-2160p-hdr"},
+	{MinHeight: 720, Preset: "h265-1080p"},
+	{Preset: "h264-compat"},
+}
+
+var (
+	hdrRegex               = regexp.MustCompile(`(?i)\bHDR|Dolby Vision|\bDoVi\b|BT\.?2020|ST\.? ?2084|\bHLG\b`)
+	ffmpegProgressRegex    = regexp.MustCompile(`^out_time_(?:us|ms)=(\d+)$`)
+	handbrakeProgressRegex = regexp.MustCompile(`Encoding: task \d+ of \d+, ([0-9.]+) %`)
+)
+
+// isHDR tells HDR video apart by the stream's descriptions, as makemkv has no dedicated attribute for it.
+func isHDR(stream Stream) bool {
+	for _, text := range []string{stream.CodecLong, stream.Attr, stream.LongDesc, stream.Notes} {
+		if hdrRegex.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func videoHeight(v Video) int {
+	_, height, _ := strings.Cut(v.Resolution, "x")
+	return atoi(height)
+}
+
+func transcodePresets(config Config) map[string]TranscodePreset {
+	presets := map[string]TranscodePreset{}
+	for name, preset := range builtinPresets {
+		presets[name] = preset
+	}
+	for name, preset := range config.Transcode.Presets {
+		presets[name] = preset
+	}
+	return presets
+}
+
+// transcodePreset returns the preset of a title: the one named by --transcode, or the first matching
+// rule for --transcode auto.
+func transcodePreset(t Title, args Arguments, config Config) string {
+	if args.Transcode != "auto" {
+		return args.Transcode
+	}
+	if len(t.Video) == 0 {
+		return ""
+	}
+	rules := config.Transcode.Rules
+	if len(rules) == 0 {
+		rules = defaultTranscodeRules
+	}
+	height := videoHeight(t.Video[0])
+	for _, rule := range rules {
+		if rule.MinHeight > 0 && height < rule.MinHeight {
+			continue
+		}
+		if rule.MaxHeight > 0 && height > rule.MaxHeight {
+			continue
+		}
+		if rule.HDR != nil && *rule.HDR != t.Video[0].HDR {
+			continue
+		}
+		return rule.Preset
+	}
+	return ""
+}
+
+func transcodePolicy(args Arguments, config Config) string {
+	return firstNonEmpty(args.TranscodePolicy, config.Transcode.Policy, "keep")
+}
+
+// validateTranscode exits on unknown presets or policies before anything is ripped.
+func validateTranscode(args Arguments, config Config) {
+	if args.Transcode == "" {
+		return
+	}
+	presets := transcodePresets(config)
+	names := []string{args.Transcode}
+	if args.Transcode == "auto" {
+		names = names[:0]
+		rules := config.Transcode.Rules
+		if len(rules) == 0 {
+			rules = defaultTranscodeRules
+		}
+		for _, rule := range rules {
+			names = append(names, rule.Preset)
+		}
+	}
+	for _, name := range names {
+		preset, ok := presets[name]
+		if !ok {
+			known := make([]string, 0, len(presets))
+			for k := range presets {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			fmt.Printf("Unknown transcode preset %q, expected auto or one of: %s\n", name, strings.Join(known, ", "))
+			os.Exit(1)
+		}
+		if preset.Tool != "ffmpeg" && preset.Tool != "handbrake" {
+			fmt.Printf("Transcode preset %q has unknown tool %q, expected ffmpeg or handbrake\n", name, preset.Tool)
+			os.Exit(1)
+		}
+	}
+	if policy := transcodePolicy(args, config); policy != "keep" && policy != "replace" {
+		fmt.Printf("Unknown transcode policy %q, expected keep or replace\n", policy)
+		os.Exit(1)
+	}
+}
+
+type transcodeResult struct {
+	Preset string
+	Output string
+	Err    error
+}
+
+// transcoder runs the transcode stage alongside the rip: finished titles are queued while the drive keeps
+// ripping, and up to Jobs encoders run at once.
+type transcoder struct {
+	ctx     context.Context
+	args    Arguments
+	config  Config
+	presets map[string]TranscodePreset
+	policy  string
+
+	jobs    chan func()
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results map[int]transcodeResult
+}
+
+func newTranscoder(ctx context.Context, args Arguments, config Config) *transcoder {
+	if args.Transcode == "" {
+		return nil
+	}
+	jobs := args.TranscodeJobs
+	if jobs <= 0 {
+		jobs = config.Transcode.Jobs
+	}
+	if jobs <= 0 {
+		jobs = 1
+	}
+
+	tr := &transcoder{
+		ctx:     ctx,
+		args:    args,
+		config:  config,
+		presets: transcodePresets(config),
+		policy:  transcodePolicy(args, config),
+		jobs:    make(chan func()),
+		results: map[int]transcodeResult{},
+	}
+	for i := 0; i < jobs; i++ {
+		go func() {
+			for job := range tr.jobs {
+				job()
+			}
+		}()
+	}
+	return tr
+}
+
+// Submit queues a finished output for transcoding. It reports false when no preset applies to the title.
+func (tr *transcoder) Submit(t Title, input string) bool {
+	name := transcodePreset(t, tr.args, tr.config)
+	if name == "" {
+		return false
+	}
+	tr.wg.Add(1)
+	job := func() {
+		defer tr.wg.Done()
+		result := transcodeResult{Preset: name}
+		result.Output, result.Err = tr.transcode(t, input, name, tr.presets[name])
+		tr.mu.Lock()
+		tr.results[t.ID] = result
+		tr.mu.Unlock()
+	}
+	go func() { tr.jobs <- job }()
+	return true
+}
+
+// Wait waits for every queued transcode and returns the results by title ID.
+func (tr *transcoder) Wait() map[int]transcodeResult {
+	tr.wg.Wait()
+	close(tr.jobs)
+	return tr.results
+}
+
+func (tr *transcoder) transcode(t Title, input string, name string, preset TranscodePreset) (string, error) {
+	if tr.ctx.Err() != nil {
+		return "", tr.ctx.Err()
+	}
+	release, err := acquireSlot(tr.ctx, SlotTranscode)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	output, tmp := transcodeOutput(input, name, preset, tr.policy)
+	defer os.Remove(tmp)
+
+	cmd := transcodeCommand(tr.ctx, preset, input, tmp)
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = 30 * time.Second
+
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Transcoding title %02d with %s...\n", t.ID, name)
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("%s: %w", preset.Tool, err)
+	}
+	reportTranscodeProgress(stdout, t, name, preset.Tool)
+	if err := cmd.Wait(); err != nil {
+		if tr.ctx.Err() != nil {
+			return "", tr.ctx.Err()
+		}
+		return "", fmt.Errorf("%s: %v: %s", preset.Tool, err, lastLine(errb.String()))
+	}
+
+	if err := os.Rename(tmp, output); err != nil {
+		return "", err
+	}
+	hashes := newFileHashes(hashNames(tr.args.Hash))
+	if tr.policy == "replace" && output != input {
+		if err := os.Remove(input); err != nil {
+			return output, err
+		}
+		if err := hashes.Forget(input); err != nil {
+			return output, fmt.Errorf("error writing checksums: %w", err)
+		}
+	}
+	if err := readInto(output, hashes.Writer()); err != nil {
+		return output, fmt.Errorf("error hashing %s: %w", output, err)
+	}
+	if err := hashes.Record(output); err != nil {
+		return output, fmt.Errorf("error writing checksums: %w", err)
+	}
+	fmt.Printf("Transcoded title %02d ==> %s\n", t.ID, output)
+	return output, nil
+}
+
+// transcodeOutput returns the final path of a transcode and the path it is encoded to. Encoding goes to a
+// hidden file next to the output so a failed or cancelled transcode never leaves a half-written file under
+// the final name.
+func transcodeOutput(input string, name string, preset TranscodePreset, policy string) (string, string) {
+	ext := firstNonEmpty(preset.Extension, ".mkv")
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	base := strings.TrimSuffix(input, filepath.Ext(input))
+	output := base + "." + name + ext
+	if policy == "replace" {
+		output = base + ext
+	}
+	return output, filepath.Join(filepath.Dir(output), "."+filepath.Base(base)+".transcoding"+ext)
+}
+
+func transcodeCommand(ctx context.Context, preset TranscodePreset, input string, output string) *exec.Cmd {
+	if preset.Tool == "handbrake" {
+		argv := []string{"-i", input, "-o", output}
+		return exec.CommandContext(ctx, "HandBrakeCLI", append(argv, preset.Args...)...)
+	}
+	argv := []string{"-hide_banner", "-nostdin", "-loglevel", "error", "-y", "-i", input}
+	argv = append(argv, preset.Args...)
+	argv = append(argv, "-progress", "pipe:1", "-nostats", output)
+	return exec.CommandContext(ctx, "ffmpeg", argv...)
+}
+
+// reportTranscodeProgress prints the progress of a transcode in steps of 10%.
+// ffmpeg reports the encoded position, HandBrakeCLI a percentage.
+func reportTranscodeProgress(r io.Reader, t Title, name string, tool string) {
+	total := float64(durationSeconds(t.Duration))
+	reported := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(scanLinesOrCR)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var percent float64
+		if tool == "handbrake" {
+			matches := handbrakeProgressRegex.FindStringSubmatch(line)
+			if matches == nil {
+				continue
+			}
+			percent, _ = strconv.ParseFloat(matches[1], 64)
+		} else {
+			matches := ffmpegProgressRegex.FindStringSubmatch(line)
+			if matches == nil || total == 0 {
+				continue
+			}
+			us, _ := strconv.ParseFloat(matches[1], 64)
+			percent = us / 1e6 / total * 100
+		}
+		if step := int(percent) / 10 * 10; step > reported && step < 100 {
+			reported = step
+			fmt.Printf("Transcoding title %02d with %s: %d%%\n", t.ID, name, step)
+		}
+	}
+}
+
+// scanLinesOrCR splits on \n and \r, as progress lines are often rewritten in place with \r.
+func scanLinesOrCR(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
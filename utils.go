@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 )
 
 func atoi(s string) int {
@@ -58,7 +63,66 @@ func sizeToBytes(size string) int64 {
 	}
 }
 
-func copyFile(src, dst string) error {
+// sanitizeFilename replaces characters that are invalid in file names on common filesystems.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		default:
+			return r
+		}
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "_"
+	}
+	return name
+}
+
+func durationSeconds(duration string) int64 {
+	var seconds int64
+	for _, part := range strings.Split(strings.TrimSpace(duration), ":") {
+		seconds = seconds*60 + atoi64(part)
+	}
+	return seconds
+}
+
+func bitrateToBps(bitrate string) int64 {
+	regex := regexp.MustCompile(`^(?P<val>[0-9.]+) ?(?P<mult>[KkMmGg])?b/s$`)
+	matches := regex.FindStringSubmatch(strings.TrimSpace(bitrate))
+	if matches == nil {
+		return 0
+	}
+
+	value, _ := strconv.ParseFloat(matches[1], 64)
+	switch strings.ToUpper(matches[2]) {
+	case "K":
+		value *= 1000
+	case "M":
+		value *= 1000 * 1000
+	case "G":
+		value *= 1000 * 1000 * 1000
+	}
+	return int64(value)
+}
+
+func bytesToSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
+
+// copyFile copies src to dst and fsyncs it. The copied bytes are also written to tee when it is not nil.
+func copyFile(src, dst string, tee io.Writer) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
@@ -71,6 +135,124 @@ func copyFile(src, dst string) error {
 	}
 	defer destFile.Close()
 
-	_, err = io.Copy(destFile, sourceFile)
+	var w io.Writer = destFile
+	if tee != nil {
+		w = io.MultiWriter(destFile, tee)
+	}
+	if _, err = io.Copy(w, sourceFile); err != nil {
+		return err
+	}
+	if err = destFile.Sync(); err != nil {
+		return err
+	}
+	return destFile.Close()
+}
+
+// moveFile moves src to dst. Unless replace is set it never replaces an existing dst, failing with an
+// error matching fs.ErrExist instead: another rip may have written the same path since it was checked.
+// Across filesystems it copies to a hidden temporary file next to dst, fsyncs and verifies the size, moves
+// it into place, and only then removes src, so dst never appears half-written.
+// The file content is written to tee exactly once, during the copy or after the move.
+func moveFile(src, dst string, replace bool, tee io.Writer) error {
+	err := placeFile(src, dst, replace)
+	if err == nil {
+		if tee != nil {
+			if err := readInto(dst, tee); err != nil {
+				return err
+			}
+		}
+		return syncDir(filepath.Dir(dst))
+	}
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.partial")
+	if err != nil {
+		return err
+	}
+	partial := tmp.Name()
+	tmp.Close()
+	if err := copyFile(src, partial, tee); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := os.Chmod(partial, srcInfo.Mode().Perm()); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	partialInfo, err := os.Stat(partial)
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if srcInfo.Size() != partialInfo.Size() {
+		os.Remove(partial)
+		return fmt.Errorf("size mismatch copying %s: wrote %d of %d bytes", src, partialInfo.Size(), srcInfo.Size())
+	}
+
+	if err := placeFile(partial, dst, replace); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	if err := syncDir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// placeFile renames src onto dst on the same filesystem. Without replace it links dst and then removes
+// src, since a link fails when dst exists where a rename would silently replace it. Filesystems without
+// hard links, e.g. exFAT, fall back to a rename after checking that dst does not exist.
+func placeFile(src, dst string, replace bool) error {
+	if replace {
+		return os.Rename(src, dst)
+	}
+	err := os.Link(src, dst)
+	if err == nil {
+		return os.Remove(src)
+	}
+	if errors.Is(err, fs.ErrExist) || errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		return &fs.PathError{Op: "move", Path: dst, Err: fs.ErrExist}
+	}
+	return os.Rename(src, dst)
+}
+
+func readInto(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
 	return err
 }
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// shellJoin quotes argv for display so it can be pasted into a POSIX shell.
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+:,./@%") == "" {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
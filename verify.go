@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+)
+
+type MKVTrack struct {
+	ID         int    `json:"id"`
+	Type       string `json:"type"` // video | audio | subtitles
+	Codec      string `json:"codec"`
+	Properties struct {
+		Language      string `json:"language"`
+		LanguageIETF  string `json:"language_ietf"`
+		TrackName     string `json:"track_name"`
+		DefaultTrack  bool   `json:"default_track"`
+		ForcedTrack   bool   `json:"forced_track"`
+		AudioChannels int    `json:"audio_channels"`
+	} `json:"properties"`
+}
+
+type MKVInfo struct {
+	Container struct {
+		Properties struct {
+			Duration int64  `json:"duration"` // nanoseconds
+			Title    string `json:"title"`
+		} `json:"properties"`
+	} `json:"container"`
+	Tracks   []MKVTrack `json:"tracks"`
+	Chapters []struct {
+		NumEntries int `json:"num_entries"`
+	} `json:"chapters"`
+}
+
+func (info MKVInfo) DurationSeconds() float64 {
+	return float64(info.Container.Properties.Duration) / 1e9
+}
+
+func (info MKVInfo) ChapterCount() int {
+	n := 0
+	for _, edition := range info.Chapters {
+		n += edition.NumEntries
+	}
+	return n
+}
+
+func (info MKVInfo) TracksOfType(kind string) []MKVTrack {
+	return filter(info.Tracks, func(t MKVTrack) bool { return t.Type == kind })
+}
+
+func inspectMKV(file string) (MKVInfo, error) {
+	var info MKVInfo
+	var output, errb bytes.Buffer
+	cmd := exec.Command("mkvmerge", "-J", file)
+	cmd.Stdout, cmd.Stderr = &output, &errb
+	if err := cmd.Run(); err != nil {
+		return info, fmt.Errorf("mkvmerge -J: %v: %s", err, strings.TrimSpace(errb.String()+output.String()))
+	}
+	if err := json.Unmarshal(output.Bytes(), &info); err != nil {
+		return info, fmt.Errorf("mkvmerge -J: %w", err)
+	}
+	return info, nil
+}
+
+// VerifyOutput compares a ripped file against the source title and the streams the selection kept.
+// It returns a line per mismatch.
+func VerifyOutput(file string, t Title, kept map[int]bool, tolerance VerifyConfig) []string {
+	info, err := inspectMKV(file)
+	if err != nil {
+		return []string{fmt.Sprintf("could not inspect output: %v", err)}
+	}
+
+	var issues []string
+
+	maxDrift := tolerance.DurationSeconds
+	if maxDrift <= 0 {
+		maxDrift = 2
+	}
+	expected := float64(durationSeconds(t.Duration))
+	actual := info.DurationSeconds()
+	if math.Abs(actual-expected) > maxDrift {
+		issues = append(issues, fmt.Sprintf("duration %s, expected %s (±%.0fs)", formatSeconds(actual), t.Duration, maxDrift))
+	}
+
+	if chapters := info.ChapterCount(); absInt(chapters-t.Chapters) > tolerance.Chapters {
+		issues = append(issues, fmt.Sprintf("%d chapter(s), expected %d", chapters, t.Chapters))
+	}
+
+	var videoLangs, audioLangs, subLangs []string
+	for _, v := range t.Video {
+		if kept[v.StreamID] {
+			videoLangs = append(videoLangs, "")
+		}
+	}
+	for _, a := range t.Audio {
+		if kept[a.StreamID] {
+			audioLangs = append(audioLangs, normalizeLang(a.LanguageCode))
+		}
+	}
+	for _, s := range t.Subtitles {
+		if kept[s.StreamID] {
+			subLangs = append(subLangs, normalizeLang(s.LanguageCode))
+		}
+	}
+	issues = append(issues, compareTracks("video", videoLangs, info.TracksOfType("video"))...)
+	issues = append(issues, compareTracks("audio", audioLangs, info.TracksOfType("audio"))...)
+	issues = append(issues, compareTracks("subtitle", subLangs, info.TracksOfType("subtitles"))...)
+
+	return issues
+}
+
+// compareTracks checks track count and, where the source has one, the language of each track in order.
+func compareTracks(kind string, expected []string, actual []MKVTrack) []string {
+	if len(expected) != len(actual) {
+		return []string{fmt.Sprintf("%d %s track(s), expected %d", len(actual), kind, len(expected))}
+	}
+	var issues []string
+	for i, lang := range expected {
+		if lang == "" || lang == "und" {
+			continue
+		}
+		got := normalizeLang(actual[i].Properties.Language)
+		if !sameLang(got, lang) {
+			issues = append(issues, fmt.Sprintf("%s track %d language %s, expected %s", kind, i+1, got, lang))
+		}
+	}
+	return issues
+}
+
+func formatSeconds(seconds float64) string {
+	s := int64(math.Round(seconds))
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchedDisc is a disc watch has ripped, or tried to, recorded in <state dir>/watch.json.
+type WatchedDisc struct {
+	Fingerprint string    `json:"fingerprint"`
+	Volume      string    `json:"volume,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Device      string    `json:"device"`
+	Status      string    `json:"status"` // done | failed
+	Error       string    `json:"error,omitempty"`
+	Log         string    `json:"log"`
+	Updated     time.Time `json:"updated"`
+}
+
+// watchState is shared by the drives being ripped at once. A disc is claimed before it is ripped, so two
+// copies of a disc in two drives are not ripped twice either.
+type watchState struct {
+	mu      sync.Mutex
+	path    string
+	ripping map[string]bool
+	Discs   []WatchedDisc `json:"discs"`
+}
+
+func loadWatchState(dir string) (*watchState, error) {
+	state := &watchState{path: filepath.Join(dir, "watch.json"), ripping: map[string]bool{}}
+	data, err := os.ReadFile(state.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// claim marks a disc as being ripped. It fails when the disc was ripped before or is being ripped now,
+// returning the earlier rip if there is one.
+func (s *watchState) claim(fingerprint string) (WatchedDisc, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ripping[fingerprint] {
+		return WatchedDisc{}, false
+	}
+	for _, d := range s.Discs {
+		if d.Fingerprint == fingerprint && d.Status == "done" {
+			return d, false
+		}
+	}
+	s.ripping[fingerprint] = true
+	return WatchedDisc{}, true
+}
+
+func (s *watchState) release(fingerprint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ripping, fingerprint)
+}
+
+func (s *watchState) record(disc WatchedDisc) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ripping, disc.Fingerprint)
+	disc.Updated = time.Now().UTC()
+	s.Discs = filter(s.Discs, func(d WatchedDisc) bool { return d.Fingerprint != disc.Fingerprint })
+	s.Discs = append(s.Discs, disc)
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// discFingerprint identifies a disc by its label and title layout, which stay the same from scan to scan
+// and tell apart discs sharing a generic label.
+func discFingerprint(disc Disc) string {
+	titles := slices.Clone(disc.Titles)
+	sort.Slice(titles, func(i, j int) bool { return titles[i].ID < titles[j].ID })
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", disc.Type, disc.Name, disc.Volume)
+	for _, t := range titles {
+		fmt.Fprintf(h, "%s|%s|%s|%d\n", t.Playlist, t.Segments, t.Duration, t.Bytes)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// ListDrives asks makemkvcon for its drives. Opening the nonexistent disc:9999 makes it list the drives
+// without scanning any disc.
+func ListDrives() ([]Drive, error) {
+	cmd := exec.Command("makemkvcon", "-r", "--cache=1", "info", "disc:9999")
+	var output, errb bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &errb
+	err := cmd.Run()
+	drives := ParseDrives(output.String())
+	if err != nil && len(drives) == 0 {
+		return nil, fmt.Errorf("makemkvcon: %v: %s", err, strings.TrimSpace(errb.String()))
+	}
+	return drives, nil
+}
+
+// Watch polls the drives and rips each disc inserted with the watch options of the config, ejecting it
+// when done unless the options set another --eject. Discs are fingerprinted, and one that was ripped before
+// is ejected without ripping it again. A drive another ripmkv process is using is left alone.
+func Watch(ctx context.Context, args Arguments, config Config) error {
+	dir := serveStateDir(config)
+	if err := os.MkdirAll(filepath.Join(dir, "logs"), 0o755); err != nil {
+		return err
+	}
+	lock, err := lockInstance(dir, "watch")
+	if err != nil {
+		return err
+	}
+	defer unlockFile(lock)
+
+	ripArgs := slices.Clone(config.Watch.Args)
+	if slices.Contains(ripArgs, "-d") || slices.Contains(ripArgs, "--drive") {
+		return errors.New("watch rips the inserted discs, -d cannot be used in the watch options")
+	}
+	if args.Config != "" {
+		path, err := filepath.Abs(args.Config)
+		if err != nil {
+			return err
+		}
+		ripArgs = append([]string{"-c", path}, ripArgs...)
+	}
+	if !slices.Contains(ripArgs, "--eject") {
+		ripArgs = append(ripArgs, "--eject", EjectSuccess)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	state, err := loadWatchState(dir)
+	if err != nil {
+		return fmt.Errorf("error reading watch state: %w", err)
+	}
+
+	watched := map[string]bool{}
+	for _, device := range config.Watch.Drives {
+		watched[strings.TrimPrefix(device, "dev:")] = true
+	}
+	interval := 5 * time.Second
+	if config.Watch.Interval > 0 {
+		interval = time.Duration(config.Watch.Interval) * time.Second
+	}
+	if len(watched) > 0 {
+		fmt.Printf("Watching %s for discs\n", strings.Join(config.Watch.Drives, ", "))
+	} else {
+		fmt.Println("Watching every drive for discs")
+	}
+
+	// handled holds the drives whose disc was already picked up, until the disc is taken out. inUse holds
+	// the drives another process was found using, so that is only reported once.
+	handled := map[string]bool{}
+	inUse := map[string]bool{}
+	var wg sync.WaitGroup
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		drives, err := ListDrives()
+		if err != nil {
+			fmt.Println("Error listing drives:", err)
+		}
+		for _, d := range drives {
+			if len(watched) > 0 && !watched[d.Device] {
+				continue
+			}
+			if d.State != DriveInserted {
+				delete(handled, d.Device)
+				delete(inUse, d.Device)
+				continue
+			}
+			if handled[d.Device] {
+				continue
+			}
+			release, err := lockDrive("dev:" + d.Device)
+			if err != nil {
+				if !inUse[d.Device] {
+					fmt.Printf("%v, waiting for it.\n", err)
+					inUse[d.Device] = true
+				}
+				continue
+			}
+			handled[d.Device] = true
+			delete(inUse, d.Device)
+			fmt.Printf("%s: disc %s inserted\n", d.Device, d.Disc)
+			wg.Add(1)
+			go func(device string) {
+				defer wg.Done()
+				watchDisc(ctx, exe, dir, device, ripArgs, state, release)
+			}(d.Device)
+		}
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchDisc scans the disc in a drive and rips it in a ripmkv child process logging to the state directory.
+// It holds the drive lock from the scan until the child has ejected the disc and exited.
+func watchDisc(ctx context.Context, exe string, dir string, device string, ripArgs []string, state *watchState, release func()) {
+	defer release()
+	disc, err := ScanDisc(Arguments{Drive: device})
+	if err != nil {
+		fmt.Printf("%s: %v\n", device, err)
+		return
+	}
+	fingerprint := discFingerprint(disc)
+	label := firstNonEmpty(disc.Name, disc.Volume, device)
+	if previous, ok := state.claim(fingerprint); !ok {
+		if previous.Status == "" {
+			fmt.Printf("%s: %s is being ripped in another drive, leaving it.\n", device, label)
+			return
+		}
+		fmt.Printf("%s: %s was already ripped on %s, ejecting.\n", device, label, previous.Updated.Local().Format("2006-01-02 15:04"))
+		if err := ejectDisc(device); err != nil {
+			fmt.Printf("%s: %v\n", device, err)
+		}
+		return
+	}
+
+	argv := append(slices.Clone(ripArgs), "-d", device)
+	result := WatchedDisc{
+		Fingerprint: fingerprint,
+		Volume:      disc.Volume,
+		Name:        disc.Name,
+		Device:      device,
+		Log: filepath.Join(dir, "logs", fmt.Sprintf("watch-%s-%s.log",
+			time.Now().Format("20060102-150405"), sanitizeFilename(firstNonEmpty(disc.Volume, fingerprint)))),
+	}
+
+	err = runWatchRip(ctx, exe, argv, device, result.Log)
+	if ctx.Err() != nil {
+		state.release(fingerprint)
+		fmt.Printf("%s: rip of %s cancelled\n", device, label)
+		return
+	}
+	if err != nil {
+		result.Status, result.Error = "failed", err.Error()
+		fmt.Printf("%s: rip of %s failed: %v, see %s\n", device, label, err, result.Log)
+	} else {
+		result.Status = "done"
+		fmt.Printf("%s: %s ripped.\n", device, label)
+	}
+	if err := state.record(result); err != nil {
+		fmt.Println("Error writing watch state:", err)
+	}
+}
+
+// runWatchRip runs the rip of a drive whose lock watch holds, telling the child not to take it.
+func runWatchRip(ctx context.Context, exe string, argv []string, device string, logPath string) error {
+	log, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cmd := exec.CommandContext(ctx, exe, argv...)
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = 30 * time.Second
+	if _, path, ok := driveLockPath("dev:" + device); ok {
+		cmd.Env = append(os.Environ(), envDriveLocked+"="+path)
+	}
+	cmd.Stdout = log
+	cmd.Stderr = log
+	fmt.Fprintf(log, "=== %s %s\n", time.Now().Format(time.RFC3339), shellJoin(append([]string{"ripmkv"}, argv...)))
+	return cmd.Run()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+// xxh64 is the 64-bit xxHash with seed 0, the format written by xxhsum.
+type xxh64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func newXXH64() hash.Hash64 {
+	d := &xxh64{}
+	d.Reset()
+	return d
+}
+
+func (d *xxh64) Reset() {
+	var p1 = xxPrime1
+	d.v = [4]uint64{p1 + xxPrime2, xxPrime2, 0, -p1}
+	d.total = 0
+	d.n = 0
+}
+
+func (d *xxh64) Size() int      { return 8 }
+func (d *xxh64) BlockSize() int { return 32 }
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMerge(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func (d *xxh64) stripe(b []byte) {
+	d.v[0] = xxRound(d.v[0], binary.LittleEndian.Uint64(b[0:]))
+	d.v[1] = xxRound(d.v[1], binary.LittleEndian.Uint64(b[8:]))
+	d.v[2] = xxRound(d.v[2], binary.LittleEndian.Uint64(b[16:]))
+	d.v[3] = xxRound(d.v[3], binary.LittleEndian.Uint64(b[24:]))
+}
+
+func (d *xxh64) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+
+	if d.n+len(b) < 32 {
+		d.n += copy(d.mem[d.n:], b)
+		return n, nil
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.stripe(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+	for ; len(b) >= 32; b = b[32:] {
+		d.stripe(b)
+	}
+	d.n = copy(d.mem[:], b)
+	return n, nil
+}
+
+func (d *xxh64) Sum64() uint64 {
+	var h uint64
+	if d.total >= 32 {
+		h = bits.RotateLeft64(d.v[0], 1) + bits.RotateLeft64(d.v[1], 7) +
+			bits.RotateLeft64(d.v[2], 12) + bits.RotateLeft64(d.v[3], 18)
+		for _, v := range d.v {
+			h = xxMerge(h, v)
+		}
+	} else {
+		h = xxPrime5
+	}
+	h += d.total
+
+	b := d.mem[:d.n]
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func (d *xxh64) Sum(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, d.Sum64())
+}
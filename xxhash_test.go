@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestXXH64(t *testing.T) {
+	long := strings.Repeat("0123456789abcdef", 8) + "xyz" // several stripes plus a tail
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "ef46db3751d8e999"},
+		{"a", "d24ec4f1a98c6e5b"},
+		{"abc", "44bc2cf5ad770999"},
+		{"Nobody inspects the spammish repetition", "fbcea83c8a378bf1"},
+		{long, "cc37f915170d24b0"},
+	}
+	for _, tt := range tests {
+		if got := xxh64Hex(tt.input); got != tt.want {
+			t.Errorf("xxh64(%.20q) = %s, want %s", tt.input, got, tt.want)
+		}
+		// Writes split at any point must give the digest of the whole input.
+		for split := 0; split <= len(tt.input); split++ {
+			h := newXXH64()
+			h.Write([]byte(tt.input[:split]))
+			h.Write([]byte(tt.input[split:]))
+			if got := fmt.Sprintf("%016x", h.Sum64()); got != tt.want {
+				t.Errorf("xxh64(%.20q) written in two parts at %d = %s, want %s", tt.input, split, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestXXH64Sum(t *testing.T) {
+	h := newXXH64()
+	h.Write([]byte("abc"))
+	if got := fmt.Sprintf("%x", h.Sum([]byte("prefix"))); got != fmt.Sprintf("%x", "prefix")+"44bc2cf5ad770999" {
+		t.Errorf("Sum appended %s, want the big-endian digest after the prefix", got)
+	}
+}
+
+func xxh64Hex(s string) string {
+	h := newXXH64()
+	h.Write([]byte(s))
+	return fmt.Sprintf("%016x", h.Sum64())
+}